@@ -6,12 +6,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/shengjhe/goip/config"
 	"github.com/shengjhe/goip/internal/handler"
 	"github.com/shengjhe/goip/internal/middleware"
+	"github.com/shengjhe/goip/internal/model"
 	"github.com/shengjhe/goip/internal/repository"
 	"github.com/shengjhe/goip/internal/service"
 	"github.com/gin-gonic/gin"
@@ -36,24 +38,33 @@ func main() {
 
 	logger.Info().Msg("Starting GoIP service...")
 
-	// 初始化 GeoIP Repository（支持多提供者）
-	geoipRepo, err := initGeoIPRepository(cfg, logger)
+	// 初始化 Redis Client（快取與限流都不使用 Redis 時不建立連線，可不依賴 Redis 單獨執行）
+	var redisClient redis.UniversalClient
+	if cfg.UsesRedis() {
+		redisClient = initRedis(cfg.Redis, logger)
+		defer redisClient.Close()
+	}
+
+	// 初始化 GeoIP Repository（支持多提供者，使用 Redis 時外部 API 配額計數存放於 Redis）
+	geoipRepo, err := initGeoIPRepository(cfg, redisClient, logger)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to initialize GeoIP repository")
 	}
 	defer geoipRepo.Close()
 
-	// 初始化 Redis Client
-	redisClient := initRedis(cfg.Redis, logger)
-	defer redisClient.Close()
-
 	// 測試 Redis 連接
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := redisClient.Ping(ctx).Err(); err != nil {
+	if redisClient == nil {
+		logger.Info().Msg("Redis not used, running without Redis")
+	} else if err := redisClient.Ping(ctx).Err(); err != nil {
 		logger.Warn().Err(err).Msg("Redis connection failed, cache will be disabled")
 	} else {
-		logger.Info().Str("host", cfg.Redis.Host).Int("port", cfg.Redis.Port).Msg("Redis connected")
+		if cfg.Redis.Mode == "sentinel" || cfg.Redis.Mode == "cluster" {
+			logger.Info().Str("mode", cfg.Redis.Mode).Strs("addrs", cfg.Redis.Addrs).Str("master_name", cfg.Redis.MasterName).Msg("Redis connected")
+		} else {
+			logger.Info().Str("host", cfg.Redis.Host).Int("port", cfg.Redis.Port).Msg("Redis connected")
+		}
 
 		// 檢查是否需要清空緩存
 		if os.Getenv("FLUSH_DNS") == "true" {
@@ -66,15 +77,51 @@ func main() {
 	}
 
 	// 初始化 Cache Repository
-	cacheRepo := repository.NewCacheRepository(redisClient)
+	cacheRepo := initCacheRepository(cfg.Cache, redisClient)
+	logger.Info().Str("backend", cacheRepo.Backend()).Msg("Cache initialized")
 
 	// 初始化 Service
-	ipService := service.NewIPService(
-		geoipRepo,
-		cacheRepo,
-		logger,
-		cfg.Cache.TTL,
-	)
+	ipService := service.NewIPService(geoipRepo, cacheRepo, logger, service.ServiceOptions{
+		CacheTTL:        cfg.Cache.TTL,
+		TTLPolicy:       newTTLPolicy(cfg.Cache),
+		NegativeTTL:     cfg.Cache.NegativeTTL,
+		LookupTimeout:   cfg.GeoIP.LookupTimeout,
+		StaleAfter:      cfg.GeoIP.StaleAfter,
+		CleanupPrevious: cfg.Cache.CleanupPrevious,
+		Warmup: service.WarmupOptions{
+			File:       cfg.Cache.Warmup.File,
+			HotIPs:     cfg.Cache.Warmup.HotIPs,
+			Rate:       cfg.Cache.Warmup.Rate,
+			MaxTargets: cfg.Cache.Warmup.MaxTargets,
+			OnReload:   cfg.Cache.Warmup.OnReload,
+		},
+	})
+
+	// 依資料庫建置時間選擇快取命名空間，資料庫更新後自動使用新的快取
+	if result, err := ipService.SyncDatasetVersion(ctx); err == nil {
+		logger.Info().
+			Str("dataset_version", result.DatasetVersion).
+			Str("previous_version", result.PreviousVersion).
+			Bool("cleanup_started", result.CleanupStarted).
+			Msg("Cache namespace selected")
+	}
+
+	// 啟動時預熱清單檔案與上次執行時的熱門 IP（在背景以有限速率進行）
+	if cfg.Cache.Warmup.OnStartup {
+		if _, err := ipService.StartWarmup(ctx, model.WarmupRequest{}); err != nil {
+			logger.Warn().Err(err).Msg("Failed to start cache warmup")
+		}
+	}
+
+	// 資料庫過期時於啟動日誌提醒
+	for _, status := range ipService.GetProviderStatuses(ctx) {
+		if status.Metadata != nil && status.Metadata.Stale {
+			logger.Warn().
+				Str("provider", status.Name).
+				Int("age_days", status.Metadata.AgeDays).
+				Msg("GeoIP database is stale")
+		}
+	}
 
 	// 初始化 Handler
 	ipHandler := handler.NewIPHandler(
@@ -83,6 +130,8 @@ func main() {
 		geoipRepo,
 		logger,
 		cfg.Batch.MaxSize,
+		buildCanaries(cfg.GeoIP.Health),
+		healthDependencies(cfg, redisClient),
 	)
 
 	// 初始化 Gin
@@ -109,29 +158,11 @@ func main() {
 }
 
 // flushDNSCache 清空 DNS 緩存
-func flushDNSCache(ctx context.Context, redisClient *redis.Client, logger zerolog.Logger) error {
-	// 掃描所有 goip: 開頭的 key
-	var cursor uint64
-	var deletedCount int64
-
-	for {
-		keys, newCursor, err := redisClient.Scan(ctx, cursor, "goip:*", 100).Result()
-		if err != nil {
-			return fmt.Errorf("failed to scan keys: %w", err)
-		}
-
-		if len(keys) > 0 {
-			deleted, err := redisClient.Del(ctx, keys...).Result()
-			if err != nil {
-				return fmt.Errorf("failed to delete keys: %w", err)
-			}
-			deletedCount += deleted
-		}
-
-		cursor = newCursor
-		if cursor == 0 {
-			break
-		}
+func flushDNSCache(ctx context.Context, redisClient redis.UniversalClient, logger zerolog.Logger) error {
+	// 掃描所有查詢結果的 key（包含所有資料集版本，不影響配額計數等其他 goip: 資料；cluster 模式逐一 master 掃描）
+	deletedCount, err := repository.ScanDelete(ctx, redisClient, "goip:country:*")
+	if err != nil {
+		return fmt.Errorf("failed to delete keys: %w", err)
 	}
 
 	logger.Info().Int64("deleted_keys", deletedCount).Msg("Flushed DNS cache")
@@ -159,10 +190,9 @@ func initLogger(cfg config.LogConfig) zerolog.Logger {
 	return log.Logger
 }
 
-// initRedis 初始化 Redis 客戶端
-func initRedis(cfg config.RedisConfig, logger zerolog.Logger) *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+// initRedis 初始化 Redis 客戶端（standalone / sentinel / cluster）
+func initRedis(cfg config.RedisConfig, logger zerolog.Logger) redis.UniversalClient {
+	opts := &redis.UniversalOptions{
 		Password:     cfg.Password,
 		DB:           cfg.DB,
 		PoolSize:     cfg.PoolSize,
@@ -171,16 +201,46 @@ func initRedis(cfg config.RedisConfig, logger zerolog.Logger) *redis.Client {
 		DialTimeout:  cfg.DialTimeout,
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
-	})
+	}
+
+	switch cfg.Mode {
+	case "sentinel":
+		opts.Addrs = cfg.Addrs
+		opts.MasterName = cfg.MasterName
+		opts.SentinelPassword = cfg.SentinelPassword
+	case "cluster":
+		opts.Addrs = cfg.Addrs
+		opts.IsClusterMode = true
+	default:
+		opts.Addrs = []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)}
+	}
 
-	return client
+	return redis.NewUniversalClient(opts)
+}
+
+// initCacheRepository 依 cache.backend 建立快取（cache.enabled = false 時不快取）
+func initCacheRepository(cfg config.CacheConfig, redisClient redis.UniversalClient) repository.CacheRepository {
+	opts := repository.CacheOptions{
+		Stale:      newStalePolicy(cfg.Stale),
+		Compress:   cfg.Compression,
+		MaxEntries: cfg.MemoryMaxEntries,
+	}
+
+	switch cfg.EffectiveBackend() {
+	case "none":
+		return repository.NewNoopCacheRepository()
+	case "memory":
+		return repository.NewMemoryCacheRepository(opts)
+	default:
+		return repository.NewCacheRepository(redisClient, opts)
+	}
 }
 
 // setupRouter 設定路由
 func setupRouter(
 	cfg *config.Config,
 	ipHandler *handler.IPHandler,
-	redisClient *redis.Client,
+	redisClient redis.UniversalClient,
 	logger zerolog.Logger,
 ) *gin.Engine {
 	// 設定 Gin 模式
@@ -196,17 +256,6 @@ func setupRouter(
 	router.Use(middleware.Recovery(logger))
 	router.Use(middleware.Logger(logger))
 
-	// 限流中間件（如果啟用）
-	if cfg.RateLimit.Enabled {
-		rateLimiter := middleware.NewRateLimiter(
-			redisClient,
-			logger,
-			cfg.RateLimit.RequestsPerMinute,
-			cfg.RateLimit.RequestsPerHour,
-		)
-		router.Use(rateLimiter.Limit())
-	}
-
 	// 簡單的健康檢查端點（不記錄日誌）
 	router.GET("/healthz", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
@@ -215,24 +264,66 @@ func setupRouter(
 		c.String(http.StatusOK, "OK")
 	})
 
+	// Kubernetes 探針：livez 只確認程序存活，readyz 逐一檢查 Redis 與提供者
+	// 探針在驗證與限流中間件之前註冊，不受限流與配額影響，避免健康的 Pod 因 429 被重啟
+	router.GET("/livez", ipHandler.HandleLivez)
+	router.GET("/readyz", ipHandler.HandleReadyz)
+
+	// API 金鑰驗證（未啟用時不檢查）
+	requireScope := func(scope string) gin.HandlerFunc {
+		return func(c *gin.Context) { c.Next() }
+	}
+	if cfg.Auth.Enabled {
+		authenticator := newAuthenticator(cfg.Auth, redisClient, logger)
+		requireScope = authenticator.Require
+		// 先辨識金鑰，限流才能依金鑰計數
+		router.Use(authenticator.Identify())
+	}
+
+	// 限流中間件（如果啟用）
+	var rateLimiter *middleware.RateLimiter
+	if cfg.RateLimit.Enabled {
+		opts := newRateLimitOptions(cfg)
+		if cfg.RateLimitStorage() == "memory" {
+			rateLimiter = middleware.NewMemoryRateLimiter(logger, opts)
+		} else {
+			rateLimiter = middleware.NewRateLimiter(redisClient, logger, opts)
+		}
+		router.Use(rateLimiter.Limit())
+	}
+
 	// API 路由群組
 	v1 := router.Group("/api/v1")
 	{
 		// IP 查詢
-		v1.GET("/ip/:ip", ipHandler.HandleIPLookup)
-		v1.GET("/ip/:ip/provider", ipHandler.HandleIPLookupByProvider)
-		v1.POST("/ip/batch", ipHandler.HandleBatchLookup)
+		v1.GET("/ip/:ip", requireScope(middleware.ScopeLookup), ipHandler.HandleIPLookup)
+		v1.GET("/ip/:ip/provider", requireScope(middleware.ScopeLookup), ipHandler.HandleIPLookupByProvider)
+		v1.GET("/ip/:ip/compare", requireScope(middleware.ScopeLookup), ipHandler.HandleCompareProviders)
+		v1.POST("/ip/batch", requireScope(middleware.ScopeBatch), ipHandler.HandleBatchLookup)
 
 		// 系統
 		v1.GET("/health", ipHandler.HandleHealth)
-		v1.GET("/stats", ipHandler.HandleStats)
-		v1.GET("/providers", ipHandler.HandleGetProviders)
+		v1.GET("/stats", requireScope(middleware.ScopeAdmin), ipHandler.HandleStats)
+		v1.GET("/providers", requireScope(middleware.ScopeLookup), ipHandler.HandleGetProviders)
+		v1.POST("/providers/reload", requireScope(middleware.ScopeAdmin), ipHandler.HandleReloadProviders)
+
+		// 呼叫者的用量（需啟用限流）
+		if rateLimiter != nil {
+			usageHandler := handler.NewUsageHandler(rateLimiter, logger)
+			v1.GET("/usage", requireScope(middleware.ScopeAny), usageHandler.HandleUsage)
+		}
 
 		// 快取管理
-		cache := v1.Group("/cache")
+		cache := v1.Group("/cache", requireScope(middleware.ScopeAdmin))
 		{
 			cache.GET("/stats", ipHandler.HandleCacheStats)
 			cache.POST("/invalidate", ipHandler.HandleInvalidateCache)
+			cache.POST("/warmup", ipHandler.HandleStartWarmup)
+			cache.GET("/warmup", ipHandler.HandleWarmupStatus)
+			cache.DELETE("/warmup", ipHandler.HandleCancelWarmup)
+			cache.GET("/entries/:ip", ipHandler.HandleInspectCache)
+			cache.POST("/flush", ipHandler.HandleFlushCache)
+			cache.GET("/flush", ipHandler.HandleFlushStatus)
 		}
 	}
 
@@ -248,6 +339,74 @@ func setupRouter(
 	return router
 }
 
+// newAuthenticator 依配置建立 API 金鑰驗證（storage 為 redis 時另外查詢 Redis 中的金鑰）
+func newAuthenticator(cfg config.AuthConfig, redisClient redis.UniversalClient, logger zerolog.Logger) *middleware.Authenticator {
+	keys := make([]middleware.APIKey, len(cfg.Keys))
+	for i, key := range cfg.Keys {
+		keys[i] = middleware.APIKey{
+			Name:   key.Name,
+			Key:    key.Key,
+			Secret: key.Secret,
+			Scopes: key.Scopes,
+			Plan:   strings.ToLower(key.Plan),
+		}
+	}
+
+	var client redis.UniversalClient
+	if cfg.Storage == "redis" {
+		client = redisClient
+	}
+
+	logger.Info().Int("keys", len(keys)).Str("storage", cfg.Storage).Msg("API key authentication enabled")
+	return middleware.NewAuthenticator(keys, client, logger, middleware.AuthOptions{
+		AllowQueryKey:    cfg.AllowQueryKey,
+		SignatureMaxSkew: cfg.SignatureMaxSkew,
+	})
+}
+
+// healthDependencies 快取後端以外需要檢查的相依服務：限流使用 Redis 時檢查 Redis
+func healthDependencies(cfg *config.Config, redisClient redis.UniversalClient) []handler.Dependency {
+	if !cfg.RateLimit.Enabled || cfg.RateLimitStorage() != "redis" || redisClient == nil {
+		return nil
+	}
+	return []handler.Dependency{{
+		Name: "rate_limit",
+		Check: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		},
+	}}
+}
+
+// newRateLimitOptions 依配置建立限流方案：匿名請求與未指定方案的金鑰使用 rate_limit 的限額
+// 方案未設定 batch_max_size 時使用 batch.max_size
+func newRateLimitOptions(cfg *config.Config) middleware.RateLimitOptions {
+	plans := make(map[string]middleware.RatePlan, len(cfg.RateLimit.Plans))
+	for name, plan := range cfg.RateLimit.Plans {
+		batchMaxSize := plan.BatchMaxSize
+		if batchMaxSize == 0 {
+			batchMaxSize = cfg.Batch.MaxSize
+		}
+		plans[name] = middleware.RatePlan{
+			Name:              name,
+			RequestsPerMinute: plan.RequestsPerMinute,
+			RequestsPerHour:   plan.RequestsPerHour,
+			DailyQuota:        plan.DailyQuota,
+			MonthlyQuota:      plan.MonthlyQuota,
+			BatchMaxSize:      batchMaxSize,
+		}
+	}
+
+	return middleware.RateLimitOptions{
+		Default: middleware.RatePlan{
+			RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
+			RequestsPerHour:   cfg.RateLimit.RequestsPerHour,
+			BatchMaxSize:      cfg.Batch.MaxSize,
+		},
+		Plans:     plans,
+		BatchPath: "/api/v1/ip/batch",
+	}
+}
+
 // gracefulShutdown 優雅關閉
 func gracefulShutdown(srv *http.Server, timeout time.Duration, logger zerolog.Logger) {
 	quit := make(chan os.Signal, 1)
@@ -267,10 +426,10 @@ func gracefulShutdown(srv *http.Server, timeout time.Duration, logger zerolog.Lo
 }
 
 // initGeoIPRepository 初始化 GeoIP Repository
-func initGeoIPRepository(cfg *config.Config, logger zerolog.Logger) (repository.GeoIPRepository, error) {
+func initGeoIPRepository(cfg *config.Config, redisClient redis.UniversalClient, logger zerolog.Logger) (repository.GeoIPRepository, error) {
 	// 優先使用新的多提供者配置
 	if len(cfg.GeoIP.Providers) > 0 {
-		return initMultiProviderRepository(cfg.GeoIP.Providers, logger)
+		return initMultiProviderRepository(cfg.GeoIP, redisClient, logger)
 	}
 
 	// 向後相容：使用舊的 MaxMind 配置
@@ -288,10 +447,10 @@ func initGeoIPRepository(cfg *config.Config, logger zerolog.Logger) (repository.
 }
 
 // initMultiProviderRepository 初始化多提供者 Repository
-func initMultiProviderRepository(providers []config.ProviderConfig, logger zerolog.Logger) (repository.GeoIPRepository, error) {
+func initMultiProviderRepository(geoipCfg config.GeoIPConfig, redisClient redis.UniversalClient, logger zerolog.Logger) (repository.GeoIPRepository, error) {
 	var providerInfos []repository.ProviderInfo
 
-	for i, providerCfg := range providers {
+	for i, providerCfg := range geoipCfg.Providers {
 		var geoipRepo repository.GeoIPRepository
 		var err error
 
@@ -321,7 +480,22 @@ func initMultiProviderRepository(providers []config.ProviderConfig, logger zerol
 				Msg("IPIP DB loaded")
 
 		case "ip-api", "ipinfo", "ipapi.co":
-			geoipRepo, err = repository.NewExternalAPIRepository(repository.ExternalAPIType(providerCfg.Type))
+			quota := providerCfg.EffectiveQuota()
+			quotaLimiter := repository.NewQuotaLimiter(providerCfg.Type, repository.QuotaLimits{
+				PerMinute: quota.PerMinute,
+				PerDay:    quota.PerDay,
+				PerMonth:  quota.PerMonth,
+			}, redisClient)
+
+			// ip-api 的批次端點另有每分鐘 15 次的限制
+			var batchQuotaLimiter *repository.QuotaLimiter
+			if providerCfg.Type == "ip-api" {
+				batchQuotaLimiter = repository.NewQuotaLimiter(providerCfg.Type+"-batch", repository.QuotaLimits{
+					PerMinute: repository.IPAPIBatchPerMinute,
+				}, redisClient)
+			}
+
+			geoipRepo, err = repository.NewExternalAPIRepository(repository.ExternalAPIType(providerCfg.Type), quotaLimiter, batchQuotaLimiter)
 			if err != nil {
 				return nil, fmt.Errorf("failed to initialize external API provider %d: %w", i, err)
 			}
@@ -329,6 +503,9 @@ func initMultiProviderRepository(providers []config.ProviderConfig, logger zerol
 				Str("type", providerCfg.Type).
 				Int("priority", providerCfg.Priority).
 				Str("region", providerCfg.Region).
+				Int("quota_per_minute", quota.PerMinute).
+				Int("quota_per_day", quota.PerDay).
+				Int("quota_per_month", quota.PerMonth).
 				Msg("External API provider loaded")
 
 		default:
@@ -339,14 +516,160 @@ func initMultiProviderRepository(providers []config.ProviderConfig, logger zerol
 			Provider: geoipRepo,
 			Priority: providerCfg.Priority,
 			Region:   providerCfg.Region,
+			Breaker:  newCircuitBreaker(providerCfg.Type, geoipCfg.CircuitBreaker),
+			Health:   newProviderHealth(geoipCfg.Health),
 		})
 	}
 
-	multiRepo, err := repository.NewMultiProviderRepository(providerInfos)
+	routing, err := buildRoutingTable(geoipCfg.Routing)
+	if err != nil {
+		return nil, err
+	}
+
+	multiRepo, err := repository.NewMultiProviderRepository(providerInfos, repository.MultiProviderOptions{
+		Routing: routing,
+		Merge:   repository.MergePolicy(geoipCfg.Merge.Fields),
+		Consensus: repository.ConsensusOptions{
+			IncludeExternal: geoipCfg.Consensus.IncludeExternal,
+		},
+		Probe: newProbeOptions(geoipCfg.Health),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create multi-provider repository: %w", err)
 	}
 
-	logger.Info().Int("provider_count", len(providerInfos)).Msg("Multi-provider GeoIP repository initialized")
+	// 背景探測不健康的提供者（Close 時停止）
+	multiRepo.StartHealthProbes()
+
+	logger.Info().
+		Int("provider_count", len(providerInfos)).
+		Int("routing_rules", len(routing.Rules)).
+		Msg("Multi-provider GeoIP repository initialized")
 	return multiRepo, nil
 }
+
+// newTTLPolicy 依配置建立快取的 TTL 策略（viper 讀取的鍵為小寫，國家代碼轉為大寫）
+func newTTLPolicy(cfg config.CacheConfig) service.TTLPolicy {
+	countries := make(map[string]time.Duration, len(cfg.TTLPolicy.Countries))
+	for code, ttl := range cfg.TTLPolicy.Countries {
+		countries[strings.ToUpper(code)] = ttl
+	}
+
+	return service.TTLPolicy{
+		Default:     cfg.TTL,
+		DB:          cfg.TTLPolicy.DB,
+		API:         cfg.TTLPolicy.API,
+		CountryOnly: cfg.TTLPolicy.CountryOnly,
+		Providers:   cfg.TTLPolicy.Providers,
+		Countries:   countries,
+
+		ProviderLookup: cfg.TTLPolicy.ProviderLookup,
+	}
+}
+
+// newStalePolicy 依配置建立快取的 stale-while-revalidate 策略（未啟用時回傳零值）
+func newStalePolicy(cfg config.StaleConfig) repository.StalePolicy {
+	if !cfg.Enabled {
+		return repository.StalePolicy{}
+	}
+
+	return repository.StalePolicy{
+		DB: repository.StaleSettings{
+			StaleTTL:     cfg.DB.StaleTTL,
+			RefreshAhead: cfg.DB.RefreshAhead,
+		},
+		API: repository.StaleSettings{
+			StaleTTL:     cfg.API.StaleTTL,
+			RefreshAhead: cfg.API.RefreshAhead,
+		},
+	}
+}
+
+// newProviderHealth 依配置建立提供者健康追蹤（未啟用時回傳 nil）
+func newProviderHealth(cfg config.HealthConfig) *repository.ProviderHealth {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return repository.NewProviderHealth(repository.HealthSettings{
+		Window:        cfg.Window,
+		MinSamples:    cfg.MinSamples,
+		MaxErrorRate:  cfg.MaxErrorRate,
+		MaxP95Latency: cfg.MaxP95Latency,
+	})
+}
+
+// newProbeOptions 依配置建立背景探測選項（未啟用健康追蹤時不探測）
+func newProbeOptions(cfg config.HealthConfig) repository.ProbeOptions {
+	if !cfg.Enabled {
+		return repository.ProbeOptions{}
+	}
+
+	return repository.ProbeOptions{
+		Interval: cfg.ProbeInterval,
+		Canaries: buildCanaries(cfg),
+	}
+}
+
+// buildCanaries 依配置建立健康檢查用 IP（未設定時使用預設值）
+func buildCanaries(cfg config.HealthConfig) []repository.Canary {
+	if len(cfg.Canaries) == 0 {
+		return repository.DefaultCanaries
+	}
+
+	canaries := make([]repository.Canary, 0, len(cfg.Canaries))
+	for _, c := range cfg.Canaries {
+		canaries = append(canaries, repository.Canary{
+			IP:      c.IP,
+			Country: strings.ToUpper(c.Country),
+		})
+	}
+	return canaries
+}
+
+// newCircuitBreaker 依配置建立提供者斷路器（未啟用時回傳 nil）
+func newCircuitBreaker(name string, cfg config.CircuitBreakerConfig) *repository.CircuitBreaker {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return repository.NewCircuitBreaker(name, repository.CircuitBreakerSettings{
+		ConsecutiveFailures: cfg.ConsecutiveFailures,
+		FailureRatio:        cfg.FailureRatio,
+		MinRequests:         cfg.MinRequests,
+		Window:              cfg.Window,
+		CoolDown:            cfg.CoolDown,
+		HalfOpenRequests:    cfg.HalfOpenRequests,
+	})
+}
+
+// buildRoutingTable 依配置建立路由表
+func buildRoutingTable(cfg config.RoutingConfig) (repository.RoutingTable, error) {
+	table := repository.RoutingTable{
+		DetectProvider: cfg.DetectProvider,
+	}
+
+	for i, ruleCfg := range cfg.Rules {
+		name := ruleCfg.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+
+		rule, err := repository.NewRoutingRule(
+			name,
+			ruleCfg.Countries,
+			ruleCfg.Continents,
+			ruleCfg.IPVersion,
+			ruleCfg.CIDRs,
+			ruleCfg.Providers,
+			ruleCfg.StopOn,
+			ruleCfg.Fallback,
+		)
+		if err != nil {
+			return table, err
+		}
+		table.Rules = append(table.Rules, rule)
+	}
+
+	return table, nil
+}
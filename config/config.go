@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -15,6 +17,7 @@ type Config struct {
 	Redis     RedisConfig     `mapstructure:"redis"`
 	Cache     CacheConfig     `mapstructure:"cache"`
 	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Auth      AuthConfig      `mapstructure:"auth"`
 	Batch     BatchConfig     `mapstructure:"batch"`
 	Log       LogConfig       `mapstructure:"log"`
 }
@@ -36,38 +39,303 @@ type MaxMindConfig struct {
 
 // GeoIPConfig GeoIP 資料庫配置
 type GeoIPConfig struct {
-	Providers []ProviderConfig `mapstructure:"providers"`
+	Providers      []ProviderConfig     `mapstructure:"providers"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	Health         HealthConfig         `mapstructure:"health"`         // 提供者健康追蹤與自動降級
+	LookupTimeout  time.Duration        `mapstructure:"lookup_timeout"` // 單次查詢（含 fallback）的總時限
+	StaleAfter     time.Duration        `mapstructure:"stale_after"`    // 本地資料庫建置超過此時間標記為過期（0 表示不檢查）
+	Routing        RoutingConfig        `mapstructure:"routing"`
+	Merge          MergeConfig          `mapstructure:"merge"`     // ?mode=merge 的欄位合併策略
+	Consensus      ConsensusConfig      `mapstructure:"consensus"` // ?mode=consensus 的投票設定
+}
+
+// ConsensusConfig 投票模式配置
+type ConsensusConfig struct {
+	IncludeExternal bool `mapstructure:"include_external"` // 外部 API 是否參與投票（會消耗配額）
+}
+
+// MergeConfig 合併模式配置
+type MergeConfig struct {
+	// Fields 欄位 -> 提供者優先順序（country, city, location, continent, network）
+	// 未設定的欄位沿用路由規則的提供者順序
+	Fields map[string][]string `mapstructure:"fields"`
+}
+
+// mergeFields 可設定合併策略的欄位
+var mergeFields = map[string]bool{
+	"country":   true,
+	"city":      true,
+	"location":  true,
+	"continent": true,
+	"network":   true,
+}
+
+// RoutingConfig 路由規則配置
+type RoutingConfig struct {
+	DetectProvider string              `mapstructure:"detect_provider"` // 判斷國家與大洲所用的提供者（預設 maxmind）
+	Rules          []RoutingRuleConfig `mapstructure:"rules"`           // 依序比對，未設定時依 region 產生預設路由
+}
+
+// RoutingRuleConfig 單一路由規則（條件皆為 AND，未設定的條件視為符合）
+type RoutingRuleConfig struct {
+	Name       string   `mapstructure:"name"`
+	Countries  []string `mapstructure:"countries"`  // ISO 國碼
+	Continents []string `mapstructure:"continents"` // 大洲代碼
+	IPVersion  int      `mapstructure:"ip_version"` // 4 或 6
+	CIDRs      []string `mapstructure:"cidrs"`      // CIDR 列表
+	Providers  []string `mapstructure:"providers"`  // 依序查詢的提供者
+	StopOn     string   `mapstructure:"stop_on"`    // city（預設）或 country
+	Fallback   string   `mapstructure:"fallback"`   // remaining（預設）或 none
+}
+
+// CircuitBreakerConfig 提供者斷路器配置
+type CircuitBreakerConfig struct {
+	Enabled             bool          `mapstructure:"enabled"`
+	ConsecutiveFailures int           `mapstructure:"consecutive_failures"` // 連續失敗幾次後斷開
+	FailureRatio        float64       `mapstructure:"failure_ratio"`        // 窗口內失敗比例門檻（0-1）
+	MinRequests         int           `mapstructure:"min_requests"`         // 計算失敗比例的最少請求數
+	Window              time.Duration `mapstructure:"window"`               // 失敗統計窗口
+	CoolDown            time.Duration `mapstructure:"cool_down"`            // 斷開後多久進入半開探測
+	HalfOpenRequests    int           `mapstructure:"half_open_requests"`   // 半開狀態允許的探測請求數
+}
+
+// HealthConfig 提供者健康追蹤配置
+type HealthConfig struct {
+	Enabled       bool           `mapstructure:"enabled"`
+	Window        time.Duration  `mapstructure:"window"`          // 錯誤率與延遲的統計窗口
+	MinSamples    int            `mapstructure:"min_samples"`     // 判斷健康狀態前的最少樣本數
+	MaxErrorRate  float64        `mapstructure:"max_error_rate"`  // 錯誤率門檻（0-1），超過時降級
+	MaxP95Latency time.Duration  `mapstructure:"max_p95_latency"` // p95 延遲門檻，超過時降級（0 表示不使用）
+	ProbeInterval time.Duration  `mapstructure:"probe_interval"`  // 不健康提供者的探測間隔（0 表示不探測）
+	Canaries      []CanaryConfig `mapstructure:"canaries"`        // 探測與 /readyz 檢查用 IP
+}
+
+// CanaryConfig 健康檢查用 IP 與預期國碼
+type CanaryConfig struct {
+	IP      string `mapstructure:"ip"`
+	Country string `mapstructure:"country"` // 預期的 ISO 國碼（空字串表示不比對）
 }
 
 // ProviderConfig IP 資料庫提供者配置
 type ProviderConfig struct {
-	Type     string `mapstructure:"type"`      // maxmind, ipip
-	DBPath   string `mapstructure:"db_path"`   // 資料庫檔案路徑
-	Priority int    `mapstructure:"priority"`  // 優先級（數字越小優先級越高）
-	Region   string `mapstructure:"region"`    // 適用地區：cn, global, all
+	Type     string      `mapstructure:"type"`     // maxmind, ipip
+	DBPath   string      `mapstructure:"db_path"`  // 資料庫檔案路徑
+	Priority int         `mapstructure:"priority"` // 優先級（數字越小優先級越高）
+	Region   string      `mapstructure:"region"`   // 適用地區：cn, global, all
+	Quota    QuotaConfig `mapstructure:"quota"`    // 外部 API 配額（未設定時使用免費方案預設值）
+}
+
+// QuotaConfig 外部 API 配額配置（0 表示使用預設值，負數表示不限制）
+type QuotaConfig struct {
+	PerMinute int `mapstructure:"per_minute"`
+	PerDay    int `mapstructure:"per_day"`
+	PerMonth  int `mapstructure:"per_month"`
+}
+
+// defaultQuotas 各外部 API 免費方案的配額
+var defaultQuotas = map[string]QuotaConfig{
+	"ip-api":   {PerMinute: 45},
+	"ipinfo":   {PerMonth: 50000},
+	"ipapi.co": {PerDay: 1000},
+}
+
+// EffectiveQuota 取得提供者實際使用的配額，未設定的窗口套用免費方案預設值
+func (p ProviderConfig) EffectiveQuota() QuotaConfig {
+	quota := p.Quota
+	defaults := defaultQuotas[p.Type]
+
+	if quota.PerMinute == 0 {
+		quota.PerMinute = defaults.PerMinute
+	}
+	if quota.PerDay == 0 {
+		quota.PerDay = defaults.PerDay
+	}
+	if quota.PerMonth == 0 {
+		quota.PerMonth = defaults.PerMonth
+	}
+
+	return quota
 }
 
 // RedisConfig Redis 配置
 type RedisConfig struct {
-	Host         string        `mapstructure:"host"`
-	Port         int           `mapstructure:"port"`
-	Password     string        `mapstructure:"password"`
-	DB           int           `mapstructure:"db"`
-	PoolSize     int           `mapstructure:"pool_size"`
-	MinIdleConns int           `mapstructure:"min_idle_conns"`
-	MaxRetries   int           `mapstructure:"max_retries"`
-	DialTimeout  time.Duration `mapstructure:"dial_timeout"`
-	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	Mode             string        `mapstructure:"mode"`              // standalone（預設）/ sentinel / cluster
+	Host             string        `mapstructure:"host"`              // standalone 使用
+	Port             int           `mapstructure:"port"`              // standalone 使用
+	Addrs            []string      `mapstructure:"addrs"`             // sentinel 位址或 cluster 種子節點（host:port）
+	MasterName       string        `mapstructure:"master_name"`       // sentinel 監控的 master 名稱
+	SentinelPassword string        `mapstructure:"sentinel_password"` // sentinel 本身的密碼（與 master 不同時）
+	Password         string        `mapstructure:"password"`
+	DB               int           `mapstructure:"db"` // cluster 模式只支援 0
+	PoolSize         int           `mapstructure:"pool_size"`
+	MinIdleConns     int           `mapstructure:"min_idle_conns"`
+	MaxRetries       int           `mapstructure:"max_retries"`
+	DialTimeout      time.Duration `mapstructure:"dial_timeout"`
+	ReadTimeout      time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout     time.Duration `mapstructure:"write_timeout"`
 }
 
 // CacheConfig 快取配置
 type CacheConfig struct {
-	Enabled           bool          `mapstructure:"enabled"`
-	TTL               time.Duration `mapstructure:"ttl"`
-	LocalCacheEnabled bool          `mapstructure:"local_cache_enabled"`
-	LocalCacheSize    int           `mapstructure:"local_cache_size"`
-	LocalCacheTTL     time.Duration `mapstructure:"local_cache_ttl"`
+	Enabled           bool            `mapstructure:"enabled"`
+	Backend           string          `mapstructure:"backend"`            // redis（預設）或 memory；enabled = false 時不快取
+	MemoryMaxEntries  int             `mapstructure:"memory_max_entries"` // memory 後端的最大項目數
+	TTL               time.Duration   `mapstructure:"ttl"`
+	NegativeTTL       time.Duration   `mapstructure:"negative_ttl"`     // 查無資料結果的快取時間（0 表示不快取）
+	Stale             StaleConfig     `mapstructure:"stale"`            // stale-while-revalidate 與提前更新
+	TTLPolicy         TTLPolicyConfig `mapstructure:"ttl_policy"`       // 依來源、提供者、國家調整 ttl
+	CleanupPrevious   bool            `mapstructure:"cleanup_previous"` // 資料庫更新後在背景刪除上一代快取
+	Compression       bool            `mapstructure:"compression"`      // 較大的快取值以 flate 壓縮
+	Warmup            WarmupConfig    `mapstructure:"warmup"`           // 快取預熱
+	LocalCacheEnabled bool            `mapstructure:"local_cache_enabled"`
+	LocalCacheSize    int             `mapstructure:"local_cache_size"`
+	LocalCacheTTL     time.Duration   `mapstructure:"local_cache_ttl"`
+}
+
+// EffectiveBackend 實際使用的快取後端：redis / memory / none
+func (c CacheConfig) EffectiveBackend() string {
+	if !c.Enabled {
+		return "none"
+	}
+	if c.Backend == "" {
+		return "redis"
+	}
+	return c.Backend
+}
+
+// WarmupConfig 快取預熱配置：以有限速率查詢清單檔案與熱門 IP 並寫入快取
+type WarmupConfig struct {
+	OnStartup  bool   `mapstructure:"on_startup"`  // 啟動時預熱
+	OnReload   bool   `mapstructure:"on_reload"`   // 重新載入資料庫且資料集版本改變時預熱
+	File       string `mapstructure:"file"`        // IP / CIDR 清單檔案（每行一筆）
+	HotIPs     int    `mapstructure:"hot_ips"`     // 預熱查詢次數最多的前 N 個 IP（0 表示不記錄查詢次數）
+	Rate       int    `mapstructure:"rate"`        // 每秒最多查詢數
+	MaxTargets int    `mapstructure:"max_targets"` // 單次預熱最多的 IP 數量（CIDR 展開後）
+}
+
+// TTLPolicyConfig 依查詢結果調整快取的 soft TTL，未設定（0）的規則使用 cache.ttl
+// 優先順序：countries > providers > db / api；country_only 為沒有城市資料的結果的上限
+type TTLPolicyConfig struct {
+	DB             time.Duration            `mapstructure:"db"`              // 本地資料庫的結果
+	API            time.Duration            `mapstructure:"api"`             // 外部 API 的結果
+	CountryOnly    time.Duration            `mapstructure:"country_only"`    // 只有國家、沒有城市資料的結果
+	Providers      map[string]time.Duration `mapstructure:"providers"`       // 依提供者（maxmind、ipip、ip-api...）
+	Countries      map[string]time.Duration `mapstructure:"countries"`       // 依國家 ISO 代碼
+	ProviderLookup time.Duration            `mapstructure:"provider_lookup"` // 指定提供者查詢（/ip/:ip/provider）的結果
+}
+
+// validate 檢查各規則不可為負數，且需大於對應來源的 refresh_ahead（否則每次命中都會提前更新）
+func (p TTLPolicyConfig) validate(stale StaleConfig) error {
+	maxRefresh := stale.DB.RefreshAhead
+	if stale.API.RefreshAhead > maxRefresh {
+		maxRefresh = stale.API.RefreshAhead
+	}
+	if !stale.Enabled {
+		stale, maxRefresh = StaleConfig{}, 0
+	}
+
+	rules := map[string]time.Duration{"country_only": p.CountryOnly, "provider_lookup": p.ProviderLookup}
+	for name, ttl := range p.Providers {
+		rules["providers."+name] = ttl
+	}
+	for code, ttl := range p.Countries {
+		rules["countries."+code] = ttl
+	}
+
+	check := func(name string, ttl, refreshAhead time.Duration) error {
+		if ttl < 0 {
+			return fmt.Errorf("invalid cache ttl_policy.%s: %s", name, ttl)
+		}
+		if ttl > 0 && refreshAhead > 0 && ttl <= refreshAhead {
+			return fmt.Errorf("invalid cache ttl_policy.%s: %s (must be greater than stale refresh_ahead %s)", name, ttl, refreshAhead)
+		}
+		return nil
+	}
+
+	if err := check("db", p.DB, stale.DB.RefreshAhead); err != nil {
+		return err
+	}
+	if err := check("api", p.API, stale.API.RefreshAhead); err != nil {
+		return err
+	}
+	for name, ttl := range rules {
+		if err := check(name, ttl, maxRefresh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StaleConfig stale-while-revalidate 配置：ttl 為 soft TTL，到期後在 stale_ttl 內仍回傳舊資料並於背景更新
+type StaleConfig struct {
+	Enabled bool              `mapstructure:"enabled"`
+	DB      StaleSourceConfig `mapstructure:"db"`  // 本地資料庫的結果
+	API     StaleSourceConfig `mapstructure:"api"` // 外部 API 的結果
+}
+
+// StaleSourceConfig 單一資料來源的 stale-while-revalidate 配置
+type StaleSourceConfig struct {
+	StaleTTL     time.Duration `mapstructure:"stale_ttl"`     // soft TTL 到期後仍可回傳舊資料的時間
+	RefreshAhead time.Duration `mapstructure:"refresh_ahead"` // soft TTL 到期前多久開始在被查詢時提前更新（0 表示不提前）
+}
+
+// AuthConfig API 金鑰驗證配置
+type AuthConfig struct {
+	Enabled          bool           `mapstructure:"enabled"`
+	Storage          string         `mapstructure:"storage"`            // config（預設）或 redis：redis 時另外查詢 goip:apikey:<sha256(key)>
+	AllowQueryKey    bool           `mapstructure:"allow_query_key"`    // 允許以 ?api_key= 傳遞金鑰（會出現在存取日誌中）
+	SignatureMaxSkew time.Duration  `mapstructure:"signature_max_skew"` // HMAC 簽章時間戳記與伺服器時間的最大差距
+	Keys             []APIKeyConfig `mapstructure:"keys"`
+}
+
+// validate 檢查儲存方式與金鑰：名稱與金鑰不可重複，權限需為 lookup / batch / admin，方案需存在於 plans
+func (a AuthConfig) validate(plans map[string]RatePlanConfig) error {
+	if !a.Enabled {
+		return nil
+	}
+	if a.Storage != "" && a.Storage != "config" && a.Storage != "redis" {
+		return fmt.Errorf("invalid auth storage: %s (must be 'config' or 'redis')", a.Storage)
+	}
+	if a.Storage != "redis" && len(a.Keys) == 0 {
+		return fmt.Errorf("auth is enabled but no keys are configured")
+	}
+	if a.SignatureMaxSkew < 0 {
+		return fmt.Errorf("invalid auth signature_max_skew: %s", a.SignatureMaxSkew)
+	}
+
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for i, key := range a.Keys {
+		if key.Name == "" || key.Key == "" {
+			return fmt.Errorf("invalid auth keys[%d]: name and key are required", i)
+		}
+		if names[key.Name] || keys[key.Key] {
+			return fmt.Errorf("invalid auth keys[%d]: duplicate name or key", i)
+		}
+		names[key.Name], keys[key.Key] = true, true
+
+		if len(key.Scopes) == 0 {
+			return fmt.Errorf("invalid auth keys[%d] (%s): at least one scope is required", i, key.Name)
+		}
+		for _, scope := range key.Scopes {
+			if scope != "lookup" && scope != "batch" && scope != "admin" {
+				return fmt.Errorf("invalid auth keys[%d] (%s) scope: %s (must be lookup, batch or admin)", i, key.Name, scope)
+			}
+		}
+		if _, ok := plans[strings.ToLower(key.Plan)]; key.Plan != "" && !ok {
+			return fmt.Errorf("invalid auth keys[%d] (%s) plan: %s (not defined in rate_limit.plans)", i, key.Name, key.Plan)
+		}
+	}
+	return nil
+}
+
+// APIKeyConfig 配置中的 API 金鑰
+type APIKeyConfig struct {
+	Name   string   `mapstructure:"name"`
+	Key    string   `mapstructure:"key"`
+	Secret string   `mapstructure:"secret"` // HMAC 簽章密鑰（設定後此金鑰的請求必須簽章）
+	Scopes []string `mapstructure:"scopes"` // lookup / batch / admin（admin 包含所有權限）
+	Plan   string   `mapstructure:"plan"`   // rate_limit.plans 中的方案名稱（空字串使用預設限額）
 }
 
 // RateLimitConfig 限流配置
@@ -76,7 +344,51 @@ type RateLimitConfig struct {
 	RequestsPerMinute int    `mapstructure:"requests_per_minute"`
 	RequestsPerHour   int    `mapstructure:"requests_per_hour"`
 	Burst             int    `mapstructure:"burst"`
-	Storage           string `mapstructure:"storage"` // redis 或 memory
+	Storage           string `mapstructure:"storage"` // redis 或 memory（未設定時依快取後端）
+	// Plans 依 API 金鑰套用的方案，匿名請求與未指定方案的金鑰使用上方的限額
+	Plans map[string]RatePlanConfig `mapstructure:"plans"`
+}
+
+// RatePlanConfig 限流方案配置（0 表示不限制）
+type RatePlanConfig struct {
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	RequestsPerHour   int `mapstructure:"requests_per_hour"`
+	DailyQuota        int `mapstructure:"daily_quota"`    // 每日（UTC）用量上限，批次查詢依 IP 數量計算
+	MonthlyQuota      int `mapstructure:"monthly_quota"`  // 每月（UTC）用量上限
+	BatchMaxSize      int `mapstructure:"batch_max_size"` // 批次查詢最多 IP 數量（0 使用 batch.max_size）
+}
+
+// validate 檢查各方案（包含以 requests_per_minute / requests_per_hour 組成的預設方案）的數值不可為負數，
+// 且批次查詢上限（未設定時為 batch.max_size）不可超過方案中最小的限額，否則依 IP 數量計費的批次查詢永遠不會通過
+func (r RateLimitConfig) validate(batchMaxSize int) error {
+	if !r.Enabled {
+		return nil
+	}
+
+	// 鍵為錯誤訊息中的名稱
+	plans := map[string]RatePlanConfig{
+		"requests_per_minute / requests_per_hour": {RequestsPerMinute: r.RequestsPerMinute, RequestsPerHour: r.RequestsPerHour},
+	}
+	for name, plan := range r.Plans {
+		plans["plans."+name] = plan
+	}
+
+	for name, plan := range plans {
+		if plan.RequestsPerMinute < 0 || plan.RequestsPerHour < 0 || plan.DailyQuota < 0 || plan.MonthlyQuota < 0 || plan.BatchMaxSize < 0 {
+			return fmt.Errorf("invalid rate_limit %s: values must not be negative", name)
+		}
+
+		size := plan.BatchMaxSize
+		if size == 0 {
+			size = batchMaxSize
+		}
+		for _, limit := range []int{plan.RequestsPerMinute, plan.RequestsPerHour, plan.DailyQuota, plan.MonthlyQuota} {
+			if limit > 0 && size > limit {
+				return fmt.Errorf("invalid rate_limit %s: batch max size %d exceeds the limit %d", name, size, limit)
+			}
+		}
+	}
+	return nil
 }
 
 // BatchConfig 批次查詢配置
@@ -136,8 +448,28 @@ func setDefaults() {
 
 	// GeoIP (多提供者配置)
 	viper.SetDefault("geoip.providers", []ProviderConfig{})
+	viper.SetDefault("geoip.lookup_timeout", "8s")
+	viper.SetDefault("geoip.stale_after", "720h")
+	viper.SetDefault("geoip.circuit_breaker.enabled", true)
+	viper.SetDefault("geoip.circuit_breaker.consecutive_failures", 5)
+	viper.SetDefault("geoip.circuit_breaker.failure_ratio", 0.5)
+	viper.SetDefault("geoip.circuit_breaker.min_requests", 10)
+	viper.SetDefault("geoip.circuit_breaker.window", "60s")
+	viper.SetDefault("geoip.circuit_breaker.cool_down", "30s")
+	viper.SetDefault("geoip.circuit_breaker.half_open_requests", 1)
+	viper.SetDefault("geoip.health.enabled", true)
+	viper.SetDefault("geoip.health.window", "5m")
+	viper.SetDefault("geoip.health.min_samples", 20)
+	viper.SetDefault("geoip.health.max_error_rate", 0.5)
+	viper.SetDefault("geoip.health.max_p95_latency", "3s")
+	viper.SetDefault("geoip.health.probe_interval", "30s")
+	viper.SetDefault("geoip.health.canaries", []map[string]string{
+		{"ip": "8.8.8.8", "country": "US"},
+		{"ip": "1.1.1.1"},
+	})
 
 	// Redis
+	viper.SetDefault("redis.mode", "standalone")
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", 6379)
 	viper.SetDefault("redis.password", "")
@@ -151,7 +483,22 @@ func setDefaults() {
 
 	// Cache
 	viper.SetDefault("cache.enabled", true)
+	viper.SetDefault("cache.backend", "redis")
+	viper.SetDefault("cache.memory_max_entries", 100000)
 	viper.SetDefault("cache.ttl", "24h")
+	viper.SetDefault("cache.negative_ttl", "1h")
+	viper.SetDefault("cache.stale.enabled", true)
+	viper.SetDefault("cache.cleanup_previous", false)
+	viper.SetDefault("cache.compression", true)
+	viper.SetDefault("cache.warmup.on_startup", false)
+	viper.SetDefault("cache.warmup.on_reload", false)
+	viper.SetDefault("cache.warmup.hot_ips", 1000)
+	viper.SetDefault("cache.warmup.rate", 50)
+	viper.SetDefault("cache.warmup.max_targets", 10000)
+	viper.SetDefault("cache.stale.db.stale_ttl", "1h")
+	viper.SetDefault("cache.stale.db.refresh_ahead", "0s")
+	viper.SetDefault("cache.stale.api.stale_ttl", "24h")
+	viper.SetDefault("cache.stale.api.refresh_ahead", "1h")
 	viper.SetDefault("cache.local_cache_enabled", false)
 	viper.SetDefault("cache.local_cache_size", 1000)
 	viper.SetDefault("cache.local_cache_ttl", "5m")
@@ -161,7 +508,13 @@ func setDefaults() {
 	viper.SetDefault("rate_limit.requests_per_minute", 100)
 	viper.SetDefault("rate_limit.requests_per_hour", 5000)
 	viper.SetDefault("rate_limit.burst", 10)
-	viper.SetDefault("rate_limit.storage", "redis")
+	viper.SetDefault("rate_limit.storage", "") // 未設定時依快取後端決定，見 RateLimitStorage
+
+	// Auth
+	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.storage", "config")
+	viper.SetDefault("auth.allow_query_key", false)
+	viper.SetDefault("auth.signature_max_skew", "5m")
 
 	// Batch
 	viper.SetDefault("batch.max_size", 100)
@@ -188,9 +541,22 @@ func bindEnvVars() {
 	viper.BindEnv("maxmind.auto_update", "MAXMIND_AUTO_UPDATE")
 	viper.BindEnv("maxmind.update_interval", "MAXMIND_UPDATE_INTERVAL")
 
+	// GeoIP
+	viper.BindEnv("geoip.lookup_timeout", "GEOIP_LOOKUP_TIMEOUT")
+	viper.BindEnv("geoip.stale_after", "GEOIP_STALE_AFTER")
+	viper.BindEnv("geoip.circuit_breaker.enabled", "CIRCUIT_BREAKER_ENABLED")
+	viper.BindEnv("geoip.circuit_breaker.cool_down", "CIRCUIT_BREAKER_COOL_DOWN")
+	viper.BindEnv("geoip.consensus.include_external", "CONSENSUS_INCLUDE_EXTERNAL")
+	viper.BindEnv("geoip.health.enabled", "PROVIDER_HEALTH_ENABLED")
+	viper.BindEnv("geoip.health.probe_interval", "PROVIDER_HEALTH_PROBE_INTERVAL")
+
 	// Redis
+	viper.BindEnv("redis.mode", "REDIS_MODE")
 	viper.BindEnv("redis.host", "REDIS_HOST")
 	viper.BindEnv("redis.port", "REDIS_PORT")
+	viper.BindEnv("redis.addrs", "REDIS_ADDRS")
+	viper.BindEnv("redis.master_name", "REDIS_MASTER_NAME")
+	viper.BindEnv("redis.sentinel_password", "REDIS_SENTINEL_PASSWORD")
 	viper.BindEnv("redis.password", "REDIS_PASSWORD")
 	viper.BindEnv("redis.db", "REDIS_DB")
 	viper.BindEnv("redis.pool_size", "REDIS_POOL_SIZE")
@@ -202,7 +568,22 @@ func bindEnvVars() {
 
 	// Cache
 	viper.BindEnv("cache.enabled", "CACHE_ENABLED")
+	viper.BindEnv("cache.backend", "CACHE_BACKEND")
+	viper.BindEnv("cache.memory_max_entries", "CACHE_MEMORY_MAX_ENTRIES")
 	viper.BindEnv("cache.ttl", "CACHE_TTL")
+	viper.BindEnv("cache.negative_ttl", "CACHE_NEGATIVE_TTL")
+	viper.BindEnv("cache.ttl_policy.db", "CACHE_TTL_DB")
+	viper.BindEnv("cache.ttl_policy.api", "CACHE_TTL_API")
+	viper.BindEnv("cache.ttl_policy.country_only", "CACHE_TTL_COUNTRY_ONLY")
+	viper.BindEnv("cache.ttl_policy.provider_lookup", "CACHE_TTL_PROVIDER_LOOKUP")
+	viper.BindEnv("cache.stale.enabled", "CACHE_STALE_ENABLED")
+	viper.BindEnv("cache.cleanup_previous", "CACHE_CLEANUP_PREVIOUS")
+	viper.BindEnv("cache.compression", "CACHE_COMPRESSION")
+	viper.BindEnv("cache.warmup.on_startup", "CACHE_WARMUP_ON_STARTUP")
+	viper.BindEnv("cache.warmup.on_reload", "CACHE_WARMUP_ON_RELOAD")
+	viper.BindEnv("cache.warmup.file", "CACHE_WARMUP_FILE")
+	viper.BindEnv("cache.warmup.hot_ips", "CACHE_WARMUP_HOT_IPS")
+	viper.BindEnv("cache.warmup.rate", "CACHE_WARMUP_RATE")
 	viper.BindEnv("cache.local_cache_enabled", "LOCAL_CACHE_ENABLED")
 	viper.BindEnv("cache.local_cache_size", "LOCAL_CACHE_SIZE")
 	viper.BindEnv("cache.local_cache_ttl", "LOCAL_CACHE_TTL")
@@ -214,6 +595,12 @@ func bindEnvVars() {
 	viper.BindEnv("rate_limit.burst", "RATE_LIMIT_BURST")
 	viper.BindEnv("rate_limit.storage", "RATE_LIMIT_STORAGE")
 
+	// Auth
+	viper.BindEnv("auth.enabled", "AUTH_ENABLED")
+	viper.BindEnv("auth.storage", "AUTH_STORAGE")
+	viper.BindEnv("auth.allow_query_key", "AUTH_ALLOW_QUERY_KEY")
+	viper.BindEnv("auth.signature_max_skew", "AUTH_SIGNATURE_MAX_SKEW")
+
 	// Batch
 	viper.BindEnv("batch.max_size", "BATCH_MAX_SIZE")
 
@@ -223,6 +610,28 @@ func bindEnvVars() {
 	viper.BindEnv("log.output", "LOG_OUTPUT")
 }
 
+// RateLimitStorage 實際使用的限流計數儲存方式：未設定時快取後端為 redis 才使用 redis，否則使用 memory
+func (c *Config) RateLimitStorage() string {
+	if c.RateLimit.Storage != "" {
+		return c.RateLimit.Storage
+	}
+	if c.Cache.EffectiveBackend() == "redis" {
+		return "redis"
+	}
+	return "memory"
+}
+
+// UsesRedis 是否需要 Redis（快取、限流或 API 金鑰使用 Redis 時）；不需要時外部 API 配額只在本地計數
+func (c *Config) UsesRedis() bool {
+	if c.Cache.EffectiveBackend() == "redis" {
+		return true
+	}
+	if c.Auth.Enabled && c.Auth.Storage == "redis" {
+		return true
+	}
+	return c.RateLimit.Enabled && c.RateLimitStorage() == "redis"
+}
+
 // Validate 驗證配置
 func (c *Config) Validate() error {
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
@@ -262,6 +671,119 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	configured := make(map[string]bool)
+	for _, provider := range c.GeoIP.Providers {
+		configured[provider.Type] = true
+	}
+
+	for i, rule := range c.GeoIP.Routing.Rules {
+		if len(rule.Providers) == 0 && rule.Fallback == "none" {
+			return fmt.Errorf("routing rule at index %d: providers is required when fallback is 'none'", i)
+		}
+		for _, provider := range rule.Providers {
+			if !configured[provider] {
+				return fmt.Errorf("routing rule at index %d: provider '%s' is not configured", i, provider)
+			}
+		}
+	}
+
+	for field, providers := range c.GeoIP.Merge.Fields {
+		if !mergeFields[field] {
+			return fmt.Errorf("invalid merge field: %s (must be 'country', 'city', 'location', 'continent', or 'network')", field)
+		}
+		for _, provider := range providers {
+			if !configured[provider] {
+				return fmt.Errorf("merge field %s: provider '%s' is not configured", field, provider)
+			}
+		}
+	}
+
+	if c.GeoIP.LookupTimeout < 0 {
+		return fmt.Errorf("invalid geoip lookup_timeout: %s", c.GeoIP.LookupTimeout)
+	}
+	if c.GeoIP.StaleAfter < 0 {
+		return fmt.Errorf("invalid geoip stale_after: %s", c.GeoIP.StaleAfter)
+	}
+
+	switch c.Redis.Mode {
+	case "", "standalone":
+	case "sentinel":
+		if c.Redis.MasterName == "" || len(c.Redis.Addrs) == 0 {
+			return fmt.Errorf("redis sentinel mode requires master_name and addrs")
+		}
+	case "cluster":
+		if len(c.Redis.Addrs) == 0 {
+			return fmt.Errorf("redis cluster mode requires addrs")
+		}
+		if c.Redis.DB != 0 {
+			return fmt.Errorf("invalid redis db: %d (cluster mode only supports db 0)", c.Redis.DB)
+		}
+	default:
+		return fmt.Errorf("invalid redis mode: %s (must be 'standalone', 'sentinel', or 'cluster')", c.Redis.Mode)
+	}
+
+	if c.Cache.Backend != "" && c.Cache.Backend != "redis" && c.Cache.Backend != "memory" {
+		return fmt.Errorf("invalid cache backend: %s (must be 'redis' or 'memory')", c.Cache.Backend)
+	}
+	if c.Cache.MemoryMaxEntries < 0 {
+		return fmt.Errorf("invalid cache memory_max_entries: %d", c.Cache.MemoryMaxEntries)
+	}
+	if w := c.Cache.Warmup; w.HotIPs < 0 || w.Rate < 0 || w.MaxTargets < 0 {
+		return fmt.Errorf("invalid cache warmup: hot_ips, rate and max_targets must not be negative")
+	}
+	if c.RateLimit.Storage != "" && c.RateLimit.Storage != "redis" && c.RateLimit.Storage != "memory" {
+		return fmt.Errorf("invalid rate_limit storage: %s (must be 'redis' or 'memory')", c.RateLimit.Storage)
+	}
+	if err := c.RateLimit.validate(c.Batch.MaxSize); err != nil {
+		return err
+	}
+	if err := c.Auth.validate(c.RateLimit.Plans); err != nil {
+		return err
+	}
+
+	if c.Cache.NegativeTTL < 0 {
+		return fmt.Errorf("invalid cache negative_ttl: %s", c.Cache.NegativeTTL)
+	}
+	for source, stale := range map[string]StaleSourceConfig{"db": c.Cache.Stale.DB, "api": c.Cache.Stale.API} {
+		if stale.StaleTTL < 0 || stale.RefreshAhead < 0 {
+			return fmt.Errorf("invalid cache stale.%s: durations must not be negative", source)
+		}
+		if stale.RefreshAhead > 0 && stale.RefreshAhead >= c.Cache.TTL {
+			return fmt.Errorf("invalid cache stale.%s.refresh_ahead: %s (must be less than cache ttl %s)", source, stale.RefreshAhead, c.Cache.TTL)
+		}
+	}
+	if err := c.Cache.TTLPolicy.validate(c.Cache.Stale); err != nil {
+		return err
+	}
+
+	cb := c.GeoIP.CircuitBreaker
+	if cb.Enabled {
+		if cb.FailureRatio < 0 || cb.FailureRatio > 1 {
+			return fmt.Errorf("invalid circuit_breaker failure_ratio: %v (must be 0-1)", cb.FailureRatio)
+		}
+		if cb.CoolDown <= 0 {
+			return fmt.Errorf("invalid circuit_breaker cool_down: %s", cb.CoolDown)
+		}
+	}
+
+	health := c.GeoIP.Health
+	if health.Enabled {
+		if health.MaxErrorRate < 0 || health.MaxErrorRate > 1 {
+			return fmt.Errorf("invalid health max_error_rate: %v (must be 0-1)", health.MaxErrorRate)
+		}
+		if health.Window <= 0 {
+			return fmt.Errorf("invalid health window: %s", health.Window)
+		}
+		if health.ProbeInterval < 0 {
+			return fmt.Errorf("invalid health probe_interval: %s", health.ProbeInterval)
+		}
+	}
+	for _, canary := range health.Canaries {
+		if net.ParseIP(canary.IP) == nil {
+			return fmt.Errorf("invalid health canary ip: %s", canary.IP)
+		}
+	}
+
 	if c.Batch.MaxSize <= 0 || c.Batch.MaxSize > 1000 {
 		return fmt.Errorf("invalid batch max_size: %d (must be 1-1000)", c.Batch.MaxSize)
 	}
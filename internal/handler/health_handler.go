@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout 就緒檢查的總時限
+const healthCheckTimeout = 5 * time.Second
+
+// HandleHealth 健康檢查
+// @Summary 健康檢查（逐一檢查 Redis 與每個提供者）
+// @Tags System
+// @Produce json
+// @Success 200 {object} model.HealthResponse
+// @Failure 503 {object} model.HealthResponse
+// @Router /api/v1/health [get]
+func (h *IPHandler) HandleHealth(c *gin.Context) {
+	httpStatus, resp := h.checkReadiness(c.Request.Context())
+	c.JSON(httpStatus, resp)
+}
+
+// HandleLivez 存活檢查（Kubernetes liveness probe）
+// 只確認程序能回應請求，不檢查相依服務，避免相依服務異常時容器被重啟
+func (h *IPHandler) HandleLivez(c *gin.Context) {
+	c.String(http.StatusOK, "OK")
+}
+
+// HandleReadyz 就緒檢查（Kubernetes readiness probe）
+// 必要的提供者異常時回傳 503，讓流量暫時移出；degraded 仍視為就緒
+func (h *IPHandler) HandleReadyz(c *gin.Context) {
+	httpStatus, resp := h.checkReadiness(c.Request.Context())
+	c.JSON(httpStatus, resp)
+}
+
+// checkReadiness 檢查快取後端與每個提供者
+// 本地資料庫為必要（異常時 unhealthy）；快取、限流與外部 API 為選用（異常時 degraded，仍可提供服務）
+func (h *IPHandler) checkReadiness(ctx context.Context) (int, model.HealthResponse) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	status := model.HealthStatusHealthy
+	services := make(map[string]string)
+
+	// 檢查快取後端（快取不可用時退回直接查詢資料庫；不快取時不檢查）
+	if backend := h.cache.Backend(); backend != "none" {
+		if err := h.cache.HealthCheck(ctx); err != nil {
+			services[backend] = model.HealthStatusUnhealthy + ": " + err.Error()
+			status = model.HealthStatusDegraded
+		} else {
+			services[backend] = model.HealthStatusHealthy
+		}
+	}
+
+	// 檢查其他選用的相依服務（例如限流使用的 Redis，異常時限流放行所有請求）
+	for _, dep := range h.dependencies {
+		if err := dep.Check(ctx); err != nil {
+			services[dep.Name] = model.HealthStatusUnhealthy + ": " + err.Error()
+			status = model.HealthStatusDegraded
+		} else {
+			services[dep.Name] = model.HealthStatusHealthy
+		}
+	}
+
+	providers := h.service.CheckProviders(ctx, h.canaries)
+	for _, p := range providers {
+		switch {
+		case p.Status == model.HealthStatusHealthy:
+		case p.Required:
+			status = model.HealthStatusUnhealthy
+		case status == model.HealthStatusHealthy:
+			status = model.HealthStatusDegraded
+		}
+	}
+
+	httpStatus := http.StatusOK
+	if status == model.HealthStatusUnhealthy {
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	return httpStatus, model.HealthResponse{
+		Status:    status,
+		Services:  services,
+		Providers: providers,
+	}
+}
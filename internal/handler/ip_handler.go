@@ -2,10 +2,13 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/shengjhe/goip/internal/middleware"
 	"github.com/shengjhe/goip/internal/model"
 	"github.com/shengjhe/goip/internal/repository"
 	"github.com/shengjhe/goip/internal/service"
@@ -20,6 +23,14 @@ type IPHandler struct {
 	geoip        repository.GeoIPRepository
 	logger       zerolog.Logger
 	batchMaxSize int
+	canaries     []repository.Canary // 健康檢查用 IP
+	dependencies []Dependency        // 健康檢查額外檢查的相依服務
+}
+
+// Dependency 快取後端以外的選用相依服務（例如限流使用的 Redis），異常時健康狀態為 degraded
+type Dependency struct {
+	Name  string
+	Check func(ctx context.Context) error
 }
 
 // NewIPHandler 建立新的 IP Handler
@@ -29,6 +40,8 @@ func NewIPHandler(
 	geoip repository.GeoIPRepository,
 	logger zerolog.Logger,
 	batchMaxSize int,
+	canaries []repository.Canary,
+	dependencies []Dependency,
 ) *IPHandler {
 	return &IPHandler{
 		service:      service,
@@ -36,6 +49,8 @@ func NewIPHandler(
 		geoip:        geoip,
 		logger:       logger,
 		batchMaxSize: batchMaxSize,
+		canaries:     canaries,
+		dependencies: dependencies,
 	}
 }
 
@@ -45,14 +60,16 @@ func NewIPHandler(
 // @Accept json
 // @Produce json
 // @Param ip path string true "IP 地址"
+// @Param mode query string false "查詢模式 (route, merge, consensus)"
 // @Success 200 {object} model.IPInfo
 // @Failure 400 {object} model.ErrorResponse
 // @Failure 404 {object} model.ErrorResponse
 // @Router /api/v1/ip/{ip} [get]
 func (h *IPHandler) HandleIPLookup(c *gin.Context) {
 	ip := c.Param("ip")
+	mode := c.Query("mode")
 
-	result, err := h.service.LookupIP(c.Request.Context(), ip)
+	result, err := h.service.LookupIPWithMode(c.Request.Context(), ip, mode)
 	if err != nil {
 		h.handleError(c, err)
 		return
@@ -98,6 +115,26 @@ func (h *IPHandler) HandleIPLookupByProvider(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// HandleCompareProviders 比對所有提供者的查詢結果
+// @Summary 並行查詢所有提供者並比對結果
+// @Tags IP
+// @Produce json
+// @Param ip path string true "IP 地址"
+// @Success 200 {object} model.CompareResult
+// @Failure 400 {object} model.ErrorResponse
+// @Router /api/v1/ip/{ip}/compare [get]
+func (h *IPHandler) HandleCompareProviders(c *gin.Context) {
+	ip := c.Param("ip")
+
+	result, err := h.service.CompareProviders(c.Request.Context(), ip)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // HandleGetProviders 取得所有可用的提供者
 // @Summary 列出所有可用的資料庫提供者
 // @Tags System
@@ -110,9 +147,33 @@ func (h *IPHandler) HandleGetProviders(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"providers": providers,
 		"count":     len(providers),
+		"details":   h.service.GetProviderStatuses(c.Request.Context()),
 	})
 }
 
+// HandleReloadProviders 重新載入本地資料庫並切換快取命名空間
+// @Summary 重新載入本地資料庫（資料庫檔案更新後），快取自動改用新的資料集版本
+// @Tags System
+// @Produce json
+// @Success 200 {object} model.ReloadResult
+// @Failure 500 {object} model.ErrorResponse
+// @Router /api/v1/providers/reload [post]
+func (h *IPHandler) HandleReloadProviders(c *gin.Context) {
+	result, err := h.service.ReloadDatabases(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, "RELOAD_FAILED", err.Error())
+		return
+	}
+
+	h.logger.Info().
+		Str("dataset_version", result.DatasetVersion).
+		Str("previous_version", result.PreviousVersion).
+		Bool("changed", result.Changed).
+		Msg("GeoIP databases reloaded")
+
+	c.JSON(http.StatusOK, result)
+}
+
 // HandleBatchLookup 處理批次 IP 查詢
 // @Summary 批次查詢多個 IP 的地理位置
 // @Tags IP
@@ -130,10 +191,14 @@ func (h *IPHandler) HandleBatchLookup(c *gin.Context) {
 		return
 	}
 
-	// 檢查批次大小限制
-	if len(req.IPs) > h.batchMaxSize {
+	// 檢查批次大小限制（限流方案可設定不同的上限）
+	maxSize := h.batchMaxSize
+	if plan := middleware.PlanFromContext(c); plan != nil && plan.BatchMaxSize > 0 {
+		maxSize = plan.BatchMaxSize
+	}
+	if len(req.IPs) > maxSize {
 		h.respondError(c, http.StatusBadRequest, "BATCH_TOO_LARGE",
-			fmt.Sprintf("批次查詢數量超過限制，最多支援 %d 個 IP", h.batchMaxSize))
+			fmt.Sprintf("批次查詢數量超過限制，最多支援 %d 個 IP", maxSize))
 		return
 	}
 
@@ -146,51 +211,6 @@ func (h *IPHandler) HandleBatchLookup(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
-// HandleHealth 健康檢查
-// @Summary 健康檢查
-// @Tags System
-// @Produce json
-// @Success 200 {object} model.HealthResponse
-// @Failure 503 {object} model.ErrorResponse
-// @Router /api/v1/health [get]
-func (h *IPHandler) HandleHealth(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
-	defer cancel()
-
-	services := make(map[string]string)
-
-	// 檢查 Redis
-	if err := h.cache.HealthCheck(ctx); err != nil {
-		services["redis"] = "unhealthy: " + err.Error()
-	} else {
-		services["redis"] = "healthy"
-	}
-
-	// 檢查 MaxMind DB（嘗試查詢一個 IP）
-	if _, err := h.geoip.LookupCountry("8.8.8.8"); err != nil {
-		services["maxmind"] = "unhealthy: " + err.Error()
-	} else {
-		services["maxmind"] = "healthy"
-	}
-
-	// 判斷整體狀態
-	status := "healthy"
-	httpStatus := http.StatusOK
-
-	for _, svcStatus := range services {
-		if svcStatus != "healthy" {
-			status = "unhealthy"
-			httpStatus = http.StatusServiceUnavailable
-			break
-		}
-	}
-
-	c.JSON(httpStatus, model.HealthResponse{
-		Status:   status,
-		Services: services,
-	})
-}
-
 // HandleStats 獲取服務統計
 // @Summary 獲取服務統計資訊
 // @Tags System
@@ -224,19 +244,19 @@ func (h *IPHandler) HandleCacheStats(c *gin.Context) {
 // @Tags Cache
 // @Accept json
 // @Produce json
-// @Param request body model.BatchRequest true "要清除的 IP 列表"
+// @Param request body model.CacheInvalidateRequest true "要清除的 IP 列表（可指定提供者）"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} model.ErrorResponse
 // @Router /api/v1/cache/invalidate [post]
 func (h *IPHandler) HandleInvalidateCache(c *gin.Context) {
-	var req model.BatchRequest
+	var req model.CacheInvalidateRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.respondError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
 		return
 	}
 
-	if err := h.service.InvalidateCache(c.Request.Context(), req.IPs...); err != nil {
+	if err := h.service.InvalidateCache(c.Request.Context(), req.Provider, req.IPs...); err != nil {
 		h.respondError(c, http.StatusInternalServerError, "CACHE_ERROR", err.Error())
 		return
 	}
@@ -247,15 +267,147 @@ func (h *IPHandler) HandleInvalidateCache(c *gin.Context) {
 	})
 }
 
+// HandleStartWarmup 開始快取預熱
+// @Summary 在背景以有限速率查詢 IP / CIDR 清單、清單檔案或熱門 IP 並寫入快取（未指定來源時使用配置）
+// @Tags Cache
+// @Accept json
+// @Produce json
+// @Param request body model.WarmupRequest false "預熱來源"
+// @Success 202 {object} model.WarmupStatus
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Router /api/v1/cache/warmup [post]
+func (h *IPHandler) HandleStartWarmup(c *gin.Context) {
+	var req model.WarmupRequest
+
+	// 允許空的 body（使用配置的預設來源）
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.respondError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	status, err := h.service.StartWarmup(c.Request.Context(), req)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusAccepted, status)
+	case errors.Is(err, service.ErrWarmupRunning):
+		h.respondError(c, http.StatusConflict, "WARMUP_RUNNING", "已有進行中的快取預熱")
+	case errors.Is(err, service.ErrNoWarmupTargets), errors.Is(err, repository.ErrInvalidIP):
+		h.respondError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	default:
+		h.respondError(c, http.StatusInternalServerError, "WARMUP_FAILED", err.Error())
+	}
+}
+
+// HandleWarmupStatus 取得快取預熱進度
+// @Summary 取得進行中或最近一次快取預熱的進度
+// @Tags Cache
+// @Produce json
+// @Success 200 {object} model.WarmupStatus
+// @Router /api/v1/cache/warmup [get]
+func (h *IPHandler) HandleWarmupStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.WarmupStatus())
+}
+
+// HandleCancelWarmup 中止快取預熱
+// @Summary 中止進行中的快取預熱
+// @Tags Cache
+// @Produce json
+// @Success 200 {object} model.WarmupStatus
+// @Failure 404 {object} model.ErrorResponse
+// @Router /api/v1/cache/warmup [delete]
+func (h *IPHandler) HandleCancelWarmup(c *gin.Context) {
+	if !h.service.CancelWarmup() {
+		h.respondError(c, http.StatusNotFound, "WARMUP_NOT_RUNNING", "沒有進行中的快取預熱")
+		return
+	}
+	c.JSON(http.StatusOK, h.service.WarmupStatus())
+}
+
+// HandleInspectCache 查看單一快取項目
+// @Summary 查看 IP 的快取項目（剩餘時間、新鮮度、提供者與寫入時的資料集版本）
+// @Tags Cache
+// @Produce json
+// @Param ip path string true "IP 地址"
+// @Param mode query string false "查詢模式 (route, merge, consensus)"
+// @Success 200 {object} model.CacheEntryDetail
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 404 {object} model.ErrorResponse
+// @Router /api/v1/cache/entries/{ip} [get]
+func (h *IPHandler) HandleInspectCache(c *gin.Context) {
+	detail, err := h.service.InspectCache(c.Request.Context(), c.Param("ip"), c.Query("mode"))
+	if errors.Is(err, repository.ErrCacheMiss) {
+		h.respondError(c, http.StatusNotFound, "CACHE_MISS", "IP 沒有快取")
+		return
+	}
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// HandleFlushCache 選擇性清除快取
+// @Summary 在背景清除符合條件（CIDR、提供者、來源、國家）的快取，或以 all 清除所有快取
+// @Tags Cache
+// @Accept json
+// @Produce json
+// @Param request body model.CacheFlushRequest true "清除條件"
+// @Success 202 {object} model.CacheFlushStatus
+// @Failure 400 {object} model.ErrorResponse
+// @Failure 409 {object} model.ErrorResponse
+// @Router /api/v1/cache/flush [post]
+func (h *IPHandler) HandleFlushCache(c *gin.Context) {
+	var req model.CacheFlushRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	status, err := h.service.FlushCache(c.Request.Context(), req)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusAccepted, status)
+	case errors.Is(err, service.ErrFlushRunning):
+		h.respondError(c, http.StatusConflict, "FLUSH_RUNNING", "已有進行中的快取清除")
+	case errors.Is(err, service.ErrInvalidFlushFilter):
+		h.respondError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	default:
+		h.respondError(c, http.StatusInternalServerError, "CACHE_ERROR", err.Error())
+	}
+}
+
+// HandleFlushStatus 取得快取清除進度
+// @Summary 取得進行中或最近一次快取清除的進度
+// @Tags Cache
+// @Produce json
+// @Success 200 {object} model.CacheFlushStatus
+// @Router /api/v1/cache/flush [get]
+func (h *IPHandler) HandleFlushStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.FlushStatus())
+}
+
 // handleError 統一錯誤處理
 func (h *IPHandler) handleError(c *gin.Context, err error) {
-	switch err {
-	case repository.ErrInvalidIP:
+	switch {
+	case errors.Is(err, repository.ErrInvalidIP):
 		h.respondError(c, http.StatusBadRequest, "INVALID_IP", "IP 地址格式無效")
-	case repository.ErrIPNotFound:
+	case errors.Is(err, repository.ErrUnknownMode):
+		h.respondError(c, http.StatusBadRequest, "INVALID_MODE", "不支援的查詢模式")
+	case errors.Is(err, repository.ErrReservedIP):
+		h.respondError(c, http.StatusNotFound, "RESERVED_IP", "保留位址沒有地理位置資料")
+	case repository.IsNotFound(err):
 		h.respondError(c, http.StatusNotFound, "IP_NOT_FOUND", "IP 不在資料庫中")
-	case repository.ErrDatabaseClosed:
+	case errors.Is(err, repository.ErrDatabaseClosed):
 		h.respondError(c, http.StatusServiceUnavailable, "DB_ERROR", "資料庫連接已關閉")
+	case errors.Is(err, repository.ErrCircuitOpen):
+		h.respondError(c, http.StatusServiceUnavailable, "PROVIDER_UNAVAILABLE", "提供者暫時停用（斷路器開啟）")
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		h.respondError(c, http.StatusServiceUnavailable, "PROVIDER_QUOTA_EXCEEDED", "外部 API 配額已用盡")
+	case errors.Is(err, context.DeadlineExceeded):
+		h.respondError(c, http.StatusGatewayTimeout, "LOOKUP_TIMEOUT", "查詢逾時")
 	default:
 		h.respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 	}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shengjhe/goip/internal/middleware"
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// UsageHandler 用量查詢處理器
+type UsageHandler struct {
+	limiter *middleware.RateLimiter
+	logger  zerolog.Logger
+}
+
+// NewUsageHandler 建立新的用量查詢處理器
+func NewUsageHandler(limiter *middleware.RateLimiter, logger zerolog.Logger) *UsageHandler {
+	return &UsageHandler{
+		limiter: limiter,
+		logger:  logger,
+	}
+}
+
+// HandleUsage 查詢呼叫者的用量
+// @Summary 查詢呼叫者（API 金鑰或用戶端 IP）的限流方案與用量
+// @Tags System
+// @Produce json
+// @Success 200 {object} model.UsageReport
+// @Failure 500 {object} model.ErrorResponse
+// @Router /api/v1/usage [get]
+func (h *UsageHandler) HandleUsage(c *gin.Context) {
+	report, err := h.limiter.Usage(c)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to read usage")
+		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+			Error:     "無法取得用量",
+			Code:      "USAGE_UNAVAILABLE",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
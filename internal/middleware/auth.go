@@ -0,0 +1,378 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// API 金鑰權限
+const (
+	ScopeLookup = "lookup" // 單一 IP 查詢
+	ScopeBatch  = "batch"  // 批次查詢
+	ScopeAdmin  = "admin"  // 快取管理、重新載入、統計（包含所有權限）
+
+	// ScopeAny 只要求有效的金鑰，不檢查權限
+	ScopeAny = ""
+)
+
+const (
+	// apiKeyHeader 傳遞 API 金鑰的 header
+	apiKeyHeader = "X-API-Key"
+	// apiKeyQuery 傳遞 API 金鑰的查詢參數（需啟用 allow_query_key）
+	apiKeyQuery = "api_key"
+	// timestampHeader HMAC 簽章的時間戳記（Unix 秒）
+	timestampHeader = "X-Timestamp"
+	// signatureHeader HMAC-SHA256 簽章（hex）
+	signatureHeader = "X-Signature"
+
+	// apiKeyRedisPrefix Redis 中的金鑰，鍵為 goip:apikey:<sha256(key)>
+	apiKeyRedisPrefix = "goip:apikey:"
+	// apiKeyCacheTTL 從 Redis 讀取的金鑰在本地保留的時間
+	apiKeyCacheTTL = time.Minute
+
+	// apiKeyContextKey 驗證通過的金鑰存放於 gin context 的鍵
+	apiKeyContextKey = "api_key"
+	// authErrorContextKey Identify 驗證失敗的原因存放於 gin context 的鍵
+	authErrorContextKey = "auth_error"
+	// apiKeyIDLength 金鑰識別碼（SHA-256 前綴）的長度
+	apiKeyIDLength = 16
+
+	// defaultSignatureMaxSkew 未設定時簽章時間戳記與伺服器時間的最大差距
+	defaultSignatureMaxSkew = 5 * time.Minute
+)
+
+var (
+	ErrMissingAPIKey    = errors.New("missing API key")
+	ErrInvalidAPIKey    = errors.New("invalid API key")
+	ErrInvalidSignature = errors.New("invalid request signature")
+)
+
+// APIKey API 金鑰
+type APIKey struct {
+	ID     string   // 識別碼（金鑰 SHA-256 的前綴，用於限流與用量計數）
+	Name   string   // 識別名稱（記錄於日誌，不含金鑰本身）
+	Key    string   // 金鑰
+	Secret string   // HMAC 簽章密鑰（設定後此金鑰的請求必須簽章）
+	Scopes []string // lookup / batch / admin
+	Plan   string   // 限流方案（空字串使用預設方案）
+}
+
+// HasScope 是否具有權限（admin 包含所有權限）
+func (k *APIKey) HasScope(scope string) bool {
+	if scope == ScopeAny {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthOptions 驗證選項
+type AuthOptions struct {
+	AllowQueryKey    bool          // 允許以 ?api_key= 傳遞金鑰
+	SignatureMaxSkew time.Duration // 簽章時間戳記與伺服器時間的最大差距
+}
+
+// apiKeyStore 金鑰的儲存方式，找不到時回傳 ErrInvalidAPIKey
+type apiKeyStore interface {
+	lookup(ctx context.Context, hash string) (*APIKey, error)
+}
+
+// Authenticator API 金鑰驗證中間件
+type Authenticator struct {
+	stores []apiKeyStore
+	logger zerolog.Logger
+	opts   AuthOptions
+}
+
+// NewAuthenticator 建立驗證中間件：先查詢配置中的金鑰，client 不為 nil 時再查詢 Redis
+func NewAuthenticator(keys []APIKey, client redis.UniversalClient, logger zerolog.Logger, opts AuthOptions) *Authenticator {
+	if opts.SignatureMaxSkew <= 0 {
+		opts.SignatureMaxSkew = defaultSignatureMaxSkew
+	}
+
+	stores := []apiKeyStore{newConfigKeyStore(keys)}
+	if client != nil {
+		stores = append(stores, &redisKeyStore{client: client, cached: make(map[string]cachedAPIKey)})
+	}
+
+	return &Authenticator{
+		stores: stores,
+		logger: logger,
+		opts:   opts,
+	}
+}
+
+// Identify 辨識請求的金鑰供限流使用，不檢查權限也不拒絕請求（驗證失敗的原因交由 Require 回應）
+func (a *Authenticator) Identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, err := a.authenticate(c); err != nil {
+			c.Set(authErrorContextKey, err)
+		} else {
+			c.Set(apiKeyContextKey, key)
+		}
+		c.Next()
+	}
+}
+
+// Require 驗證 API 金鑰（與簽章）並檢查權限
+func (a *Authenticator) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := a.authenticate(c)
+		if err != nil {
+			a.logger.Warn().Err(err).Str("client_ip", c.ClientIP()).Str("path", c.Request.URL.Path).Msg("Authentication failed")
+
+			code := "UNAUTHORIZED"
+			if errors.Is(err, ErrInvalidSignature) {
+				code = "INVALID_SIGNATURE"
+			}
+			respondAuthError(c, http.StatusUnauthorized, code, err.Error())
+			return
+		}
+
+		if !key.HasScope(scope) {
+			respondAuthError(c, http.StatusForbidden, "FORBIDDEN", fmt.Sprintf("API key does not have %s scope", scope))
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// authenticate 取得並驗證請求的金鑰，金鑰設定了密鑰時驗證簽章
+func (a *Authenticator) authenticate(c *gin.Context) (*APIKey, error) {
+	// 同一請求經過多個 Require 時只驗證一次
+	if key := APIKeyFromContext(c); key != nil {
+		return key, nil
+	}
+	if value, ok := c.Get(authErrorContextKey); ok {
+		if err, ok := value.(error); ok {
+			return nil, err
+		}
+	}
+
+	raw := c.GetHeader(apiKeyHeader)
+	if raw == "" && a.opts.AllowQueryKey {
+		raw = c.Query(apiKeyQuery)
+	}
+	if raw == "" {
+		return nil, ErrMissingAPIKey
+	}
+
+	key, err := a.lookup(c.Request.Context(), hashAPIKey(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Secret != "" {
+		if err := a.verifySignature(c, key.Secret); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// lookup 依序查詢各儲存方式
+func (a *Authenticator) lookup(ctx context.Context, hash string) (*APIKey, error) {
+	for _, store := range a.stores {
+		key, err := store.lookup(ctx, hash)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ErrInvalidAPIKey) {
+			a.logger.Warn().Err(err).Msg("API key lookup failed")
+		}
+	}
+	return nil, ErrInvalidAPIKey
+}
+
+// verifySignature 驗證 HMAC-SHA256 簽章：
+// hex(HMAC(secret, METHOD + "\n" + PATH + "\n" + RAW_QUERY + "\n" + TIMESTAMP + "\n" + hex(SHA256(BODY))))
+func (a *Authenticator) verifySignature(c *gin.Context, secret string) error {
+	timestamp := c.GetHeader(timestampHeader)
+	signature := c.GetHeader(signatureHeader)
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("%w: %s and %s headers are required", ErrInvalidSignature, timestampHeader, signatureHeader)
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidSignature)
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > a.opts.SignatureMaxSkew || skew < -a.opts.SignatureMaxSkew {
+		return fmt.Errorf("%w: timestamp expired", ErrInvalidSignature)
+	}
+
+	// 讀取 body 計算雜湊後放回，供 handler 讀取
+	var body []byte
+	if c.Request.Body != nil {
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			return fmt.Errorf("%w: cannot read body", ErrInvalidSignature)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := SignRequest(secret, c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignRequest 計算請求的 HMAC-SHA256 簽章（hex）
+func SignRequest(secret, method, path, rawQuery, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + rawQuery + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// APIKeyFromContext 取得驗證通過的金鑰，未驗證時回傳 nil
+func APIKeyFromContext(c *gin.Context) *APIKey {
+	if value, ok := c.Get(apiKeyContextKey); ok {
+		if key, ok := value.(*APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// redactAPIKey 遮蔽查詢字串中的 API 金鑰，避免寫入日誌
+func redactAPIKey(rawQuery string) string {
+	if !strings.Contains(rawQuery, apiKeyQuery+"=") {
+		return rawQuery
+	}
+
+	// 格式錯誤的參數會被略過，不會回傳原文
+	values, _ := url.ParseQuery(rawQuery)
+	values.Set(apiKeyQuery, "REDACTED")
+	return values.Encode()
+}
+
+// hashAPIKey 金鑰的 SHA-256（hex），儲存與比對時都不使用金鑰原文
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// configKeyStore 配置中的金鑰
+type configKeyStore struct {
+	keys map[string]*APIKey // sha256(key) -> 金鑰
+}
+
+func newConfigKeyStore(keys []APIKey) *configKeyStore {
+	store := &configKeyStore{keys: make(map[string]*APIKey, len(keys))}
+	for i := range keys {
+		hash := hashAPIKey(keys[i].Key)
+		keys[i].ID = hash[:apiKeyIDLength]
+		store.keys[hash] = &keys[i]
+	}
+	return store
+}
+
+func (s *configKeyStore) lookup(ctx context.Context, hash string) (*APIKey, error) {
+	if key, ok := s.keys[hash]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidAPIKey
+}
+
+// cachedAPIKey 從 Redis 讀取的金鑰（nil 表示不存在）
+type cachedAPIKey struct {
+	key       *APIKey
+	expiresAt time.Time
+}
+
+// redisKeyStore Redis 中的金鑰：Hash goip:apikey:<sha256(key)>，欄位 name、secret、scopes（逗號分隔）、plan
+// 讀取結果在本地保留 apiKeyCacheTTL，新增或撤銷金鑰最多延遲這麼久生效
+type redisKeyStore struct {
+	client redis.UniversalClient
+
+	mu        sync.Mutex
+	cached    map[string]cachedAPIKey
+	lastSweep time.Time
+}
+
+func (s *redisKeyStore) lookup(ctx context.Context, hash string) (*APIKey, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.cached[hash]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		if entry.key == nil {
+			return nil, ErrInvalidAPIKey
+		}
+		return entry.key, nil
+	}
+
+	fields, err := s.client.HGetAll(ctx, apiKeyRedisPrefix+hash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var key *APIKey
+	if len(fields) > 0 {
+		key = &APIKey{
+			ID:     hash[:apiKeyIDLength],
+			Name:   fields["name"],
+			Secret: fields["secret"],
+			Plan:   strings.ToLower(fields["plan"]),
+		}
+		for _, scope := range strings.Split(fields["scopes"], ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				key.Scopes = append(key.Scopes, scope)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	// 定期移除過期的項目，避免大量無效金鑰的請求佔用記憶體
+	if now.Sub(s.lastSweep) >= apiKeyCacheTTL {
+		for h, e := range s.cached {
+			if now.After(e.expiresAt) {
+				delete(s.cached, h)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.cached[hash] = cachedAPIKey{key: key, expiresAt: now.Add(apiKeyCacheTTL)}
+	s.mu.Unlock()
+
+	if key == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// respondAuthError 回應驗證錯誤
+func respondAuthError(c *gin.Context, httpStatus int, code, message string) {
+	c.JSON(httpStatus, model.ErrorResponse{
+		Error:     message,
+		Code:      code,
+		Timestamp: time.Now(),
+	})
+	c.Abort()
+}
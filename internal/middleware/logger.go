@@ -37,13 +37,13 @@ func Logger(logger zerolog.Logger) gin.HandlerFunc {
 		// 開始時間
 		start := time.Now()
 		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
+		query := redactAPIKey(c.Request.URL.RawQuery)
 		method := c.Request.Method
 		clientIP := c.ClientIP()
 		userAgent := c.Request.UserAgent()
 
 		// 過濾 healthcheck 請求的日誌
-		isHealthCheck := path == "/healthz" || path == "/health"
+		isHealthCheck := path == "/healthz" || path == "/health" || path == "/livez" || path == "/readyz"
 
 		// 記錄請求日誌（排除 healthcheck）
 		if !isHealthCheck {
@@ -102,6 +102,11 @@ func Logger(logger zerolog.Logger) gin.HandlerFunc {
 				}
 			}
 
+			// 如果有驗證通過的 API 金鑰，記錄金鑰名稱
+			if key := APIKeyFromContext(c); key != nil {
+				logEvent.Str("api_key", key.Name)
+			}
+
 			logEvent.Send()
 		}
 	}
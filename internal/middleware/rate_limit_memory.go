@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryRateLimitSweepInterval 清除閒置記錄的間隔
+const memoryRateLimitSweepInterval = time.Minute
+
+// memoryRateLimitBucket 單一子窗口的計數
+type memoryRateLimitBucket struct {
+	index int64 // 子窗口編號（UnixNano / 子窗口長度）
+	count int
+}
+
+// memoryRateLimitEntry 單一識別碼單一窗口的子窗口計數
+type memoryRateLimitEntry struct {
+	buckets  []memoryRateLimitBucket // 由舊到新，最多 rateLimitBuckets 筆
+	count    int                     // buckets 的計數總和
+	duration time.Duration
+}
+
+// memoryUsageEntry 單一識別碼單一期間的用量
+type memoryUsageEntry struct {
+	period string
+	bucket string
+	used   int64
+}
+
+// memoryRateLimitStore 限流計數存放於記憶體（滑動窗口）
+// 只記錄被允許的請求，每個識別碼每個窗口最多 rateLimitBuckets 筆記錄
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryRateLimitEntry
+	usages    map[string]*memoryUsageEntry
+	lastSweep time.Time
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		entries:   make(map[string]*memoryRateLimitEntry),
+		usages:    make(map[string]*memoryUsageEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// consume 在同一段鎖內檢查所有窗口與配額，全部通過時才記錄
+func (s *memoryRateLimitStore) consume(ctx context.Context, id string, windows []rateWindow, quotas []usageQuota, cost int, now time.Time) (*rejection, error) {
+	nowNano := now.UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= memoryRateLimitSweepInterval {
+		s.sweep(now)
+	}
+
+	entries := make([]*memoryRateLimitEntry, len(windows))
+	for i := range windows {
+		w := &windows[i]
+		bucket := w.bucketSize().Nanoseconds()
+
+		key := id + ":" + w.name
+		entry, ok := s.entries[key]
+		if !ok {
+			entry = &memoryRateLimitEntry{duration: w.duration}
+			s.entries[key] = entry
+		}
+		entry.expire(nowNano/bucket - rateLimitBuckets + 1)
+
+		if entry.count+cost > w.limit {
+			// 等到足夠的舊子窗口離開窗口；單次請求超過上限時等待整個窗口
+			retryAfter := int64(w.duration.Seconds())
+			need := entry.count + cost - w.limit
+			for _, b := range entry.buckets {
+				need -= b.count
+				if need <= 0 {
+					retryAfter = (b.index*bucket + w.duration.Nanoseconds() - nowNano + 1e9 - 1) / 1e9
+					break
+				}
+			}
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			return &rejection{window: w, retryAfter: retryAfter}, nil
+		}
+		entries[i] = entry
+	}
+
+	usages := make([]*memoryUsageEntry, len(quotas))
+	for i := range quotas {
+		quota := &quotas[i]
+		key := id + ":" + quota.period
+		bucket := periodBucket(quota.period, now)
+		entry, ok := s.usages[key]
+		if !ok || entry.bucket != bucket {
+			entry = &memoryUsageEntry{period: quota.period, bucket: bucket}
+			s.usages[key] = entry
+		}
+		if quota.limit > 0 && entry.used+int64(cost) > int64(quota.limit) {
+			return &rejection{quota: quota}, nil
+		}
+		usages[i] = entry
+	}
+
+	for i, entry := range entries {
+		entry.add(nowNano/windows[i].bucketSize().Nanoseconds(), cost)
+	}
+	for _, entry := range usages {
+		entry.used += int64(cost)
+	}
+	return nil, nil
+}
+
+// windowCount 取得窗口內已記錄的計費單位數
+func (s *memoryRateLimitStore) windowCount(ctx context.Context, id string, window rateWindow, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id+":"+window.name]
+	if !ok {
+		return 0, nil
+	}
+	entry.expire(now.UnixNano()/window.bucketSize().Nanoseconds() - rateLimitBuckets + 1)
+	return int64(entry.count), nil
+}
+
+// usage 取得各期間的用量
+func (s *memoryRateLimitStore) usage(ctx context.Context, id string, quotas []usageQuota, now time.Time) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := make([]int64, len(quotas))
+	for i, quota := range quotas {
+		if entry, ok := s.usages[id+":"+quota.period]; ok && entry.bucket == periodBucket(quota.period, now) {
+			used[i] = entry.used
+		}
+	}
+	return used, nil
+}
+
+// expire 移除編號小於 oldest 的子窗口
+func (e *memoryRateLimitEntry) expire(oldest int64) {
+	expired := 0
+	for expired < len(e.buckets) && e.buckets[expired].index < oldest {
+		e.count -= e.buckets[expired].count
+		expired++
+	}
+	e.buckets = e.buckets[expired:]
+}
+
+// add 將 cost 計入目前的子窗口
+func (e *memoryRateLimitEntry) add(index int64, cost int) {
+	if n := len(e.buckets); n > 0 && e.buckets[n-1].index == index {
+		e.buckets[n-1].count += cost
+	} else {
+		e.buckets = append(e.buckets, memoryRateLimitBucket{index: index, count: cost})
+	}
+	e.count += cost
+}
+
+// sweep 移除整個窗口內都沒有請求的記錄與已結束期間的用量（呼叫端需持有鎖）
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		bucket := entry.duration.Nanoseconds() / rateLimitBuckets
+		if len(entry.buckets) == 0 || entry.buckets[len(entry.buckets)-1].index < now.UnixNano()/bucket-rateLimitBuckets+1 {
+			delete(s.entries, key)
+		}
+	}
+	utc := now.UTC()
+	for key, entry := range s.usages {
+		if entry.bucket != periodBucket(entry.period, utc) {
+			delete(s.usages, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/shengjhe/goip/internal/model"
@@ -14,120 +19,470 @@ import (
 
 const (
 	rateLimitKeyPrefix = "goip:ratelimit:"
+	usageKeyPrefix     = "goip:usage:"
+
+	// rateLimitBuckets 每個滑動窗口分成的子窗口數量（分鐘窗口為每秒、小時窗口為每分鐘一個計數）
+	rateLimitBuckets = 60
+
+	// ratePlanContextKey 請求適用的限流方案存放於 gin context 的鍵
+	ratePlanContextKey = "rate_plan"
+
+	// defaultPlanName 匿名請求與未指定方案的金鑰使用的方案名稱
+	defaultPlanName = "default"
 )
 
-// RateLimiter Redis 限流中間件
+// consumeScript 原子地檢查所有滑動窗口與配額，全部通過時才記錄 cost
+// 滑動窗口以 Hash 記錄各子窗口的計數（欄位為子窗口編號），記憶體用量與上限無關
+// KEYS 為各窗口的 Hash 與各期間的用量計數；ARGV 為
+// now（毫秒）、cost、窗口數量、各窗口的（長度毫秒、子窗口毫秒、上限）、各配額的（上限、TTL 秒）
+// 回傳 {0, 0, 0} 表示通過；{1, 窗口索引, 可再次請求的時間（毫秒）}；{2, 配額索引, 0}
+// 舊版以 Sorted Set 記錄的鍵會直接刪除
+var consumeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local nw = tonumber(ARGV[3])
+local nq = #KEYS - nw
+local current = {}
+for i = 1, nw do
+	local window = tonumber(ARGV[1 + 3 * i])
+	local bucket = tonumber(ARGV[2 + 3 * i])
+	local limit = tonumber(ARGV[3 + 3 * i])
+	if redis.call('TYPE', KEYS[i]).ok ~= 'hash' then
+		redis.call('DEL', KEYS[i])
+	end
+	current[i] = math.floor(now / bucket)
+	local oldest = current[i] - math.floor(window / bucket) + 1
+	local fields = redis.call('HGETALL', KEYS[i])
+	local count = 0
+	local live = {}
+	local expired = {}
+	for k = 1, #fields, 2 do
+		local b = tonumber(fields[k])
+		if b < oldest then
+			table.insert(expired, fields[k])
+		else
+			local n = tonumber(fields[k + 1])
+			count = count + n
+			table.insert(live, {b, n})
+		end
+	end
+	if #expired > 0 then
+		redis.call('HDEL', KEYS[i], unpack(expired))
+	end
+	if count + cost > limit then
+		table.sort(live, function(x, y) return x[1] < y[1] end)
+		local need = count + cost - limit
+		for _, e in ipairs(live) do
+			need = need - e[2]
+			if need <= 0 then
+				return {1, i, e[1] * bucket + window}
+			end
+		end
+		return {1, i, now + window}
+	end
+end
+local base = 3 + 3 * nw
+for j = 1, nq do
+	local limit = tonumber(ARGV[base + 2 * j - 1])
+	if limit > 0 and tonumber(redis.call('GET', KEYS[nw + j]) or '0') + cost > limit then
+		return {2, j, 0}
+	end
+end
+for i = 1, nw do
+	redis.call('HINCRBY', KEYS[i], current[i], cost)
+	redis.call('PEXPIRE', KEYS[i], tonumber(ARGV[1 + 3 * i]) + 60000)
+end
+for j = 1, nq do
+	redis.call('INCRBY', KEYS[nw + j], cost)
+	if redis.call('TTL', KEYS[nw + j]) < 0 then
+		redis.call('EXPIRE', KEYS[nw + j], ARGV[base + 2 * j])
+	end
+end
+return {0, 0, 0}
+`)
+
+// RatePlan 限流方案（0 表示不限制）
+type RatePlan struct {
+	Name              string
+	RequestsPerMinute int
+	RequestsPerHour   int
+	DailyQuota        int // 每日（UTC）用量上限，批次查詢依 IP 數量計算
+	MonthlyQuota      int // 每月（UTC）用量上限
+	BatchMaxSize      int // 批次查詢最多 IP 數量（0 使用 batch.max_size）
+}
+
+// MaxCost 單一請求可通過的最大計費單位（各限額中最小的值，0 表示不限制）
+func (p *RatePlan) MaxCost() int {
+	maxCost := 0
+	for _, limit := range []int{p.RequestsPerMinute, p.RequestsPerHour, p.DailyQuota, p.MonthlyQuota} {
+		if limit > 0 && (maxCost == 0 || limit < maxCost) {
+			maxCost = limit
+		}
+	}
+	return maxCost
+}
+
+// RateLimitOptions 限流選項
+type RateLimitOptions struct {
+	Default   RatePlan            // 匿名請求與未指定方案的金鑰
+	Plans     map[string]RatePlan // 方案名稱 -> 方案
+	BatchPath string              // 依 IP 數量計費的批次查詢路由（空字串表示每個請求都計 1）
+}
+
+// rateWindow 滑動窗口限流
+type rateWindow struct {
+	name     string // minute / hour
+	limit    int
+	duration time.Duration
+}
+
+// bucketSize 子窗口長度
+func (w *rateWindow) bucketSize() time.Duration {
+	return w.duration / rateLimitBuckets
+}
+
+// usageQuota 固定期間的用量配額
+type usageQuota struct {
+	period string // day / month
+	limit  int
+}
+
+// rejection 被拒絕的原因
+type rejection struct {
+	window     *rateWindow // 超過的滑動窗口
+	quota      *usageQuota // 超過的配額
+	retryAfter int64       // 建議等待秒數（滑動窗口）
+}
+
+// rateLimitStore 限流計數的儲存方式
+type rateLimitStore interface {
+	// consume 檢查所有窗口與配額加上 cost 筆請求是否超過上限，全部通過時才記錄；超過時回傳拒絕的原因
+	consume(ctx context.Context, id string, windows []rateWindow, quotas []usageQuota, cost int, now time.Time) (*rejection, error)
+	// windowCount 取得窗口內已記錄的計費單位數
+	windowCount(ctx context.Context, id string, window rateWindow, now time.Time) (int64, error)
+	// usage 取得各期間的用量
+	usage(ctx context.Context, id string, quotas []usageQuota, now time.Time) ([]int64, error)
+}
+
+// RateLimiter 限流中間件
+// 帶有 API 金鑰的請求以金鑰計數並套用金鑰的方案，其他請求以用戶端 IP 計數
 type RateLimiter struct {
-	client          *redis.Client
-	logger          zerolog.Logger
-	requestsPerMin  int
-	requestsPerHour int
+	store  rateLimitStore
+	logger zerolog.Logger
+	opts   RateLimitOptions
+}
+
+// NewRateLimiter 建立新的限流中間件（計數存放於 Redis，多個實例共用限額）
+func NewRateLimiter(client redis.UniversalClient, logger zerolog.Logger, opts RateLimitOptions) *RateLimiter {
+	return newRateLimiter(&redisRateLimitStore{client: client}, logger, opts)
 }
 
-// NewRateLimiter 建立新的限流中間件
-func NewRateLimiter(client *redis.Client, logger zerolog.Logger, rpm, rph int) *RateLimiter {
+// NewMemoryRateLimiter 建立計數存放於記憶體的限流中間件（不需要 Redis，限額以實例為單位）
+func NewMemoryRateLimiter(logger zerolog.Logger, opts RateLimitOptions) *RateLimiter {
+	return newRateLimiter(newMemoryRateLimitStore(), logger, opts)
+}
+
+func newRateLimiter(store rateLimitStore, logger zerolog.Logger, opts RateLimitOptions) *RateLimiter {
+	if opts.Default.Name == "" {
+		opts.Default.Name = defaultPlanName
+	}
 	return &RateLimiter{
-		client:          client,
-		logger:          logger,
-		requestsPerMin:  rpm,
-		requestsPerHour: rph,
+		store:  store,
+		logger: logger,
+		opts:   opts,
 	}
 }
 
-// Limit 限流中間件
+// Limit 限流中間件（需放在 Authenticator.Identify 之後才能依金鑰計數）
 func (rl *RateLimiter) Limit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
+		id, plan := rl.identify(c)
+		c.Set(ratePlanContextKey, plan)
+
 		ctx := c.Request.Context()
+		cost := rl.cost(c, plan)
 
-		// 檢查分鐘級限流
-		if rl.requestsPerMin > 0 {
-			allowed, retryAfter, err := rl.checkLimit(ctx, ip, "minute", rl.requestsPerMin, time.Minute)
-			if err != nil {
-				rl.logger.Warn().Err(err).Str("ip", ip).Msg("Rate limit check failed, allowing request")
-			} else if !allowed {
-				rl.respondRateLimitExceeded(c, retryAfter)
-				return
-			}
+		// 批次查詢超過方案最小的限額時永遠不會通過，回應 400 而不是 429
+		if maxCost := plan.MaxCost(); maxCost > 0 && cost > maxCost {
+			c.JSON(http.StatusBadRequest, model.ErrorResponse{
+				Error:     fmt.Sprintf("批次查詢數量超過方案限額，最多支援 %d 個 IP", maxCost),
+				Code:      "BATCH_TOO_LARGE",
+				Timestamp: time.Now(),
+			})
+			c.Abort()
+			return
 		}
 
-		// 檢查小時級限流
-		if rl.requestsPerHour > 0 {
-			allowed, retryAfter, err := rl.checkLimit(ctx, ip, "hour", rl.requestsPerHour, time.Hour)
-			if err != nil {
-				rl.logger.Warn().Err(err).Str("ip", ip).Msg("Rate limit check failed, allowing request")
-			} else if !allowed {
-				rl.respondRateLimitExceeded(c, retryAfter)
-				return
-			}
+		// 檢查分鐘級、小時級限流與每日、每月配額，全部通過才記錄
+		// （未設定配額時也記錄用量，供 /api/v1/usage 查詢）
+		now := time.Now().UTC()
+		rejected, err := rl.store.consume(ctx, id, planWindows(plan), planQuotas(plan), cost, now)
+		if err != nil {
+			rl.logger.Warn().Err(err).Str("id", id).Msg("Rate limit check failed, allowing request")
+		} else if rejected != nil && rejected.window != nil {
+			rl.respondRateLimitExceeded(c, "RATE_LIMIT_EXCEEDED", rejected.window.limit, rejected.retryAfter)
+			return
+		} else if rejected != nil {
+			retryAfter := int64(periodReset(rejected.quota.period, now).Sub(now).Seconds()) + 1
+			rl.respondRateLimitExceeded(c, "QUOTA_EXCEEDED", rejected.quota.limit, retryAfter)
+			return
 		}
 
 		c.Next()
 	}
 }
 
-// checkLimit 使用 Sorted Set 實現滑動窗口限流
-func (rl *RateLimiter) checkLimit(ctx context.Context, ip, window string, limit int, duration time.Duration) (bool, int64, error) {
-	key := rateLimitKeyPrefix + ip + ":" + window
-	now := time.Now().UnixNano()
-	windowStart := now - duration.Nanoseconds()
+// Usage 取得請求者（API 金鑰或用戶端 IP）目前的用量
+func (rl *RateLimiter) Usage(c *gin.Context) (*model.UsageReport, error) {
+	id, plan := rl.identify(c)
+	ctx := c.Request.Context()
+	now := time.Now().UTC()
 
-	pipe := rl.client.Pipeline()
+	report := &model.UsageReport{
+		Plan:         plan.Name,
+		BatchMaxSize: plan.BatchMaxSize,
+	}
+	if key := APIKeyFromContext(c); key != nil {
+		report.Key = key.Name
+	} else {
+		report.ClientIP = c.ClientIP()
+	}
 
-	// 1. 移除過期的記錄
-	pipe.ZRemRangeByScore(ctx, key, "0", fmt.Sprintf("%d", windowStart))
+	for _, w := range []rateWindow{
+		{name: "minute", limit: plan.RequestsPerMinute, duration: time.Minute},
+		{name: "hour", limit: plan.RequestsPerHour, duration: time.Hour},
+	} {
+		used, err := rl.store.windowCount(ctx, id, w, now)
+		if err != nil {
+			return nil, err
+		}
+		report.Windows = append(report.Windows, usageWindow(w.name, w.limit, used, nil))
+	}
 
-	// 2. 獲取當前窗口內的請求數
-	zcard := pipe.ZCard(ctx, key)
+	quotas := planQuotas(plan)
+	used, err := rl.store.usage(ctx, id, quotas, now)
+	if err != nil {
+		return nil, err
+	}
+	for i, quota := range quotas {
+		resetAt := periodReset(quota.period, now)
+		report.Windows = append(report.Windows, usageWindow(quota.period, quota.limit, used[i], &resetAt))
+	}
 
-	// 3. 添加當前請求
-	pipe.ZAdd(ctx, key, redis.Z{
-		Score:  float64(now),
-		Member: now,
-	})
+	return report, nil
+}
+
+// PlanFromContext 取得請求適用的限流方案，未經過限流中間件時回傳 nil
+func PlanFromContext(c *gin.Context) *RatePlan {
+	if value, ok := c.Get(ratePlanContextKey); ok {
+		if plan, ok := value.(*RatePlan); ok {
+			return plan
+		}
+	}
+	return nil
+}
+
+// identify 取得計數的識別碼與適用的方案
+func (rl *RateLimiter) identify(c *gin.Context) (string, *RatePlan) {
+	key := APIKeyFromContext(c)
+	if key == nil {
+		return c.ClientIP(), &rl.opts.Default
+	}
+
+	plan := &rl.opts.Default
+	if p, ok := rl.opts.Plans[key.Plan]; ok {
+		plan = &p
+	}
+	return "key:" + key.ID, plan
+}
 
-	// 4. 設定過期時間
-	pipe.Expire(ctx, key, duration+time.Minute)
+// cost 請求的計費單位：批次查詢依 IP 數量計算，其他請求為 1
+// 無法解析或超過批次上限的請求計 1，由 handler 回應錯誤
+func (rl *RateLimiter) cost(c *gin.Context, plan *RatePlan) int {
+	if rl.opts.BatchPath == "" || c.Request.Method != http.MethodPost || c.FullPath() != rl.opts.BatchPath || c.Request.Body == nil {
+		return 1
+	}
 
-	_, err := pipe.Exec(ctx)
+	// 讀取 body 後放回，供 handler 讀取
+	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		return false, 0, err
+		return 1
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req model.BatchRequest
+	if err := json.Unmarshal(body, &req); err != nil || len(req.IPs) == 0 {
+		return 1
+	}
+	if plan.BatchMaxSize > 0 && len(req.IPs) > plan.BatchMaxSize {
+		return 1
+	}
+	return len(req.IPs)
+}
+
+// planWindows 方案有設定上限的滑動窗口
+func planWindows(plan *RatePlan) []rateWindow {
+	var windows []rateWindow
+	if plan.RequestsPerMinute > 0 {
+		windows = append(windows, rateWindow{name: "minute", limit: plan.RequestsPerMinute, duration: time.Minute})
+	}
+	if plan.RequestsPerHour > 0 {
+		windows = append(windows, rateWindow{name: "hour", limit: plan.RequestsPerHour, duration: time.Hour})
 	}
+	return windows
+}
 
-	count := zcard.Val()
+// planQuotas 方案的每日與每月配額（0 表示只記錄用量）
+func planQuotas(plan *RatePlan) []usageQuota {
+	return []usageQuota{
+		{period: "day", limit: plan.DailyQuota},
+		{period: "month", limit: plan.MonthlyQuota},
+	}
+}
 
-	// 如果超過限制
-	if count >= int64(limit) {
-		// 計算需要等待的時間
-		oldestCmd := rl.client.ZRange(ctx, key, 0, 0)
-		oldest, err := oldestCmd.Result()
-		if err != nil || len(oldest) == 0 {
-			return false, int64(duration.Seconds()), nil
+// usageWindow 建立單一窗口的用量（limit 為 0 時不計算剩餘數量）
+func usageWindow(name string, limit int, used int64, resetAt *time.Time) model.UsageWindow {
+	window := model.UsageWindow{
+		Window:  name,
+		Limit:   limit,
+		Used:    used,
+		ResetAt: resetAt,
+	}
+	if limit > 0 {
+		remaining := int64(limit) - used
+		if remaining < 0 {
+			remaining = 0
 		}
+		window.Remaining = &remaining
+	}
+	return window
+}
 
-		var oldestTime int64
-		fmt.Sscanf(oldest[0], "%d", &oldestTime)
-		retryAfter := (oldestTime + duration.Nanoseconds() - now) / 1e9
+// redisRateLimitStore 限流計數存放於 Redis
+type redisRateLimitStore struct {
+	client redis.UniversalClient
+}
+
+// consume 以各子窗口的計數實現滑動窗口，以計數器累加用量
+func (s *redisRateLimitStore) consume(ctx context.Context, id string, windows []rateWindow, quotas []usageQuota, cost int, now time.Time) (*rejection, error) {
+	nowMs := now.UnixMilli()
+
+	keys := make([]string, 0, len(windows)+len(quotas))
+	args := []interface{}{nowMs, cost, len(windows)}
+	for _, w := range windows {
+		keys = append(keys, rateLimitKey(id, w.name))
+		args = append(args, w.duration.Milliseconds(), w.bucketSize().Milliseconds(), w.limit)
+	}
+	for _, quota := range quotas {
+		keys = append(keys, usageKey(id, quota.period, now))
+		// 多保留一天，避免期間邊界時用量提前消失
+		args = append(args, quota.limit, int64(periodReset(quota.period, now).Sub(now).Seconds())+86400)
+	}
+
+	result, err := consumeScript.Run(ctx, s.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
 
-		if retryAfter < 0 {
+	switch result[0] {
+	case 1:
+		retryAfter := (result[2] - nowMs + 999) / 1000
+		if retryAfter < 1 {
 			retryAfter = 1
 		}
+		return &rejection{window: &windows[result[1]-1], retryAfter: retryAfter}, nil
+	case 2:
+		return &rejection{quota: &quotas[result[1]-1]}, nil
+	}
+	return nil, nil
+}
+
+// windowCount 加總窗口內各子窗口的計數
+func (s *redisRateLimitStore) windowCount(ctx context.Context, id string, window rateWindow, now time.Time) (int64, error) {
+	fields, err := s.client.HGetAll(ctx, rateLimitKey(id, window.name)).Result()
+	if err != nil {
+		// 升級前的 Sorted Set 鍵視為沒有記錄
+		if strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	bucket := window.bucketSize().Milliseconds()
+	oldest := now.UnixMilli()/bucket - rateLimitBuckets + 1
+
+	var count int64
+	for field, value := range fields {
+		b, err1 := strconv.ParseInt(field, 10, 64)
+		n, err2 := strconv.ParseInt(value, 10, 64)
+		if err1 == nil && err2 == nil && b >= oldest {
+			count += n
+		}
+	}
+	return count, nil
+}
+
+// usage 取得各期間的用量
+func (s *redisRateLimitStore) usage(ctx context.Context, id string, quotas []usageQuota, now time.Time) ([]int64, error) {
+	keys := make([]string, len(quotas))
+	for i, quota := range quotas {
+		keys[i] = usageKey(id, quota.period, now)
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make([]int64, len(quotas))
+	for i, v := range values {
+		if str, ok := v.(string); ok {
+			fmt.Sscanf(str, "%d", &used[i])
+		}
+	}
+	return used, nil
+}
+
+// rateLimitKey 產生限流鍵，使用 hash tag 讓同一識別碼的各窗口落在 cluster 的同一個 slot
+func rateLimitKey(id, window string) string {
+	return rateLimitKeyPrefix + "{" + id + "}:" + window
+}
 
-		return false, retryAfter, nil
+// usageKey 產生用量鍵：goip:usage:{<id>}:<period>:<bucket>
+func usageKey(id, period string, now time.Time) string {
+	return usageKeyPrefix + "{" + id + "}:" + period + ":" + periodBucket(period, now)
+}
+
+// periodBucket 取得時間所屬的期間編號（UTC）
+func periodBucket(period string, now time.Time) string {
+	if period == "day" {
+		return now.Format("20060102")
 	}
+	return now.Format("200601")
+}
 
-	return true, 0, nil
+// periodReset 取得期間的重設時間（UTC）
+func periodReset(period string, now time.Time) time.Time {
+	if period == "day" {
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
 }
 
 // respondRateLimitExceeded 回應限流錯誤
-func (rl *RateLimiter) respondRateLimitExceeded(c *gin.Context, retryAfter int64) {
+func (rl *RateLimiter) respondRateLimitExceeded(c *gin.Context, code string, limit int, retryAfter int64) {
 	c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
-	c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.requestsPerMin))
+	c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 	c.Header("X-RateLimit-Remaining", "0")
 
+	message := fmt.Sprintf("Rate limit exceeded. Retry after %d seconds", retryAfter)
+	if code == "QUOTA_EXCEEDED" {
+		message = fmt.Sprintf("Usage quota exceeded. Retry after %d seconds", retryAfter)
+	}
+
 	c.JSON(http.StatusTooManyRequests, model.ErrorResponse{
-		Error:     fmt.Sprintf("Rate limit exceeded. Retry after %d seconds", retryAfter),
-		Code:      "RATE_LIMIT_EXCEEDED",
+		Error:     message,
+		Code:      code,
 		Timestamp: time.Now(),
 	})
 
@@ -4,15 +4,18 @@ import "time"
 
 // IPInfo 表示 IP 查詢結果
 type IPInfo struct {
-	IP          string         `json:"ip"`                    // 必填：IP 地址
-	Country     CountryInfo    `json:"country"`               // 必填：國家資訊
-	City        CityInfo       `json:"city"`                  // 必填：城市資訊
-	Provider    string         `json:"provider"`              // 必填：資料來源（maxmind, ipip, ip-api, etc.）
-	Source      string         `json:"source,omitempty"`      // 資料來源：cache / db / api
-	Continent   *ContinentInfo `json:"continent,omitempty"`   // 選填：大洲資訊（只在有資料時顯示）
-	Location    *LocationInfo  `json:"location,omitempty"`    // 選填：經緯度資訊（只在有資料時顯示）
-	QueryTimeMs int64          `json:"query_time_ms"`         // 查詢耗時
-	CachedAt    *time.Time     `json:"cached_at,omitempty"`   // 快取時間
+	IP          string            `json:"ip"`                  // 必填：IP 地址
+	Country     CountryInfo       `json:"country"`             // 必填：國家資訊
+	City        CityInfo          `json:"city"`                // 必填：城市資訊
+	Provider    string            `json:"provider"`            // 必填：資料來源（maxmind, ipip, ip-api, etc.）
+	Source      string            `json:"source,omitempty"`    // 資料來源：cache / db / api
+	Continent   *ContinentInfo    `json:"continent,omitempty"` // 選填：大洲資訊（只在有資料時顯示）
+	Location    *LocationInfo     `json:"location,omitempty"`  // 選填：經緯度資訊（只在有資料時顯示）
+	Network     *NetworkInfo      `json:"network,omitempty"`   // 選填：網路資訊（ASN、ISP，只在有資料時顯示）
+	Sources     map[string]string `json:"sources,omitempty"`   // 合併模式：欄位 -> 提供者
+	Consensus   *ConsensusInfo    `json:"consensus,omitempty"` // 投票模式：國家投票結果
+	QueryTimeMs int64             `json:"query_time_ms"`       // 查詢耗時
+	CachedAt    *time.Time        `json:"cached_at,omitempty"` // 快取時間
 }
 
 // CountryInfo 國家資訊
@@ -42,6 +45,14 @@ type LocationInfo struct {
 	TimeZone  string  `json:"time_zone,omitempty"`
 }
 
+// NetworkInfo 網路資訊
+type NetworkInfo struct {
+	CIDR         string `json:"cidr,omitempty"`
+	ASN          string `json:"asn,omitempty"` // 例如 AS15169
+	ISP          string `json:"isp,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
 // BatchResult 批次查詢結果
 type BatchResult struct {
 	Results []IPInfo `json:"results"`
@@ -55,6 +66,12 @@ type BatchRequest struct {
 	IPs []string `json:"ips" binding:"required,min=1,max=100"`
 }
 
+// CacheInvalidateRequest 清除指定 IP 快取的請求
+type CacheInvalidateRequest struct {
+	IPs      []string `json:"ips" binding:"required,min=1,max=100"`
+	Provider string   `json:"provider,omitempty"` // 只清除指定提供者查詢的快取（未指定時清除所有查詢範圍）
+}
+
 // ErrorResponse 錯誤回應
 type ErrorResponse struct {
 	Error     string    `json:"error"`
@@ -62,31 +79,119 @@ type ErrorResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// 健康狀態
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"  // 選用的相依服務異常，仍可提供服務
+	HealthStatusUnhealthy = "unhealthy" // 必要的相依服務異常
+)
+
 // HealthResponse 健康檢查回應
 type HealthResponse struct {
-	Status   string            `json:"status"`
-	Services map[string]string `json:"services"`
+	Status    string            `json:"status"` // healthy / degraded / unhealthy
+	Services  map[string]string `json:"services"`
+	Providers []ProviderCheck   `json:"providers,omitempty"` // 各提供者檢查結果
+}
+
+// ProviderCheck 單一提供者的健康檢查結果
+type ProviderCheck struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`     // db / api
+	Required  bool   `json:"required"` // 本地資料庫為必要，外部 API 為選用
+	Status    string `json:"status"`   // healthy / degraded / unhealthy
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
 }
 
 // ServiceStats 服務統計資訊
 type ServiceStats struct {
-	TotalQueries uint64  `json:"total_queries"`
-	CacheHits    uint64  `json:"cache_hits"`
-	CacheMisses  uint64  `json:"cache_misses"`
-	CacheHitRate float64 `json:"cache_hit_rate"`
-	AvgQueryTime float64 `json:"avg_query_time_ms"`
-	TotalErrors  uint64  `json:"total_errors"`
+	TotalQueries      uint64  `json:"total_queries"`
+	CacheHits         uint64  `json:"cache_hits"`
+	CacheMisses       uint64  `json:"cache_misses"`
+	CacheHitRate      float64 `json:"cache_hit_rate"`
+	CoalescedRequests uint64  `json:"coalesced_requests"` // 共用其他請求查詢結果的次數
+	StaleHits         uint64  `json:"stale_hits"`         // 回傳已超過 soft TTL 的快取次數
+	Refreshes         uint64  `json:"refreshes"`          // 背景更新快取的次數
+	AvgQueryTime      float64 `json:"avg_query_time_ms"`
+	TotalErrors       uint64  `json:"total_errors"`
 }
 
-// CacheStats Redis 快取統計
+// CacheStats 快取統計
 type CacheStats struct {
+	Backend      string  `json:"backend"` // redis / memory / none
 	PoolHits     uint64  `json:"pool_hits"`
 	PoolMisses   uint64  `json:"pool_misses"`
 	PoolTimeouts uint64  `json:"pool_timeouts"`
-	CacheHits    uint64  `json:"cache_hits"`
-	CacheMisses  uint64  `json:"cache_misses"`
-	AvgLatency   float64 `json:"avg_latency_ms"`
+	CacheHits    uint64  `json:"cache_hits"`   // 此實例的快取命中次數（含查無資料快取）
+	CacheMisses  uint64  `json:"cache_misses"` // 此實例的快取未命中次數（含無法解碼的項目）
+	CacheErrors  uint64  `json:"cache_errors"` // Redis 錯誤次數
+	HitRate      float64 `json:"hit_rate"`
+	AvgLatency   float64 `json:"avg_latency_ms"` // 平均 Redis 往返時間
 	UsedMemory   uint64  `json:"used_memory"`
-	KeyCount     uint64  `json:"key_count"`
+	DBKeys       uint64  `json:"db_keys"`   // 目前資料庫的總鍵數（DBSIZE）
+	KeyCount     uint64  `json:"key_count"` // 查詢結果快取鍵數量（依 RANDOMKEY 抽樣估算）
 	EvictedKeys  uint64  `json:"evicted_keys"`
+	ExpiredKeys  uint64  `json:"expired_keys"`
+
+	DatasetVersion string `json:"dataset_version,omitempty"` // 目前使用的快取命名空間
+}
+
+// WarmupRequest 快取預熱請求（欄位皆未設定時使用配置的預設來源）
+type WarmupRequest struct {
+	Targets []string `json:"targets,omitempty"` // IP 或 CIDR
+	UseFile bool     `json:"use_file"`          // 讀取 cache.warmup.file
+	HotIPs  int      `json:"hot_ips"`           // 加入查詢次數最多的前 N 個 IP
+	Rate    int      `json:"rate,omitempty"`    // 每秒最多查詢數（0 使用配置值）
+}
+
+// WarmupStatus 快取預熱進度
+type WarmupStatus struct {
+	Running    bool       `json:"running"`
+	Sources    []string   `json:"sources,omitempty"` // targets / file / hot_ips
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Warmed     int        `json:"warmed"`    // 查詢後寫入快取
+	Skipped    int        `json:"skipped"`   // 已在快取中（含查無資料快取）
+	NotFound   int        `json:"not_found"` // 提供者查無資料
+	Failed     int        `json:"failed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"` // 中止原因
+}
+
+// CacheEntryDetail 單一快取項目的詳細資訊（含剩餘時間與來源）
+type CacheEntryDetail struct {
+	Key            string     `json:"key"`
+	NotFound       bool       `json:"not_found"`                 // 快取為查無資料
+	TTLSeconds     int64      `json:"ttl_seconds"`               // 剩餘時間（-1 表示不過期）
+	Freshness      string     `json:"freshness,omitempty"`       // fresh / refresh_ahead / stale
+	Provider       string     `json:"provider,omitempty"`        // 資料提供者
+	Source         string     `json:"source,omitempty"`          // 資料來源（db / api）
+	CachedAt       *time.Time `json:"cached_at,omitempty"`       // 寫入時間
+	DatasetVersion string     `json:"dataset_version,omitempty"` // 寫入時的資料集版本
+	Schema         int        `json:"schema"`                    // 快取格式版本（0 為舊版 JSON）
+	Compressed     bool       `json:"compressed"`
+	SizeBytes      int        `json:"size_bytes"`
+	Info           *IPInfo    `json:"info,omitempty"`
+}
+
+// CacheFlushRequest 選擇性清除快取的條件（多個條件需同時符合；all 清除所有資料集版本）
+type CacheFlushRequest struct {
+	CIDR     string `json:"cidr,omitempty"`     // IP 落在網段內
+	Provider string `json:"provider,omitempty"` // 資料提供者
+	Source   string `json:"source,omitempty"`   // db / api
+	Country  string `json:"country,omitempty"`  // 國家 ISO 代碼
+	All      bool   `json:"all,omitempty"`      // 清除所有快取
+}
+
+// CacheFlushStatus 清除快取工作的進度
+type CacheFlushStatus struct {
+	Running    bool              `json:"running"`
+	Filter     CacheFlushRequest `json:"filter"`
+	Scanned    int64             `json:"scanned"` // 已掃描的鍵數量
+	Matched    int64             `json:"matched"` // 符合條件的鍵數量
+	Deleted    int64             `json:"deleted"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Error      string            `json:"error,omitempty"`
 }
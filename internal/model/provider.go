@@ -0,0 +1,121 @@
+package model
+
+import "time"
+
+// ProviderStatus 提供者狀態
+type ProviderStatus struct {
+	Name           string                `json:"name"`                      // 提供者類型（maxmind, ipip, ip-api, etc.）
+	Kind           string                `json:"kind"`                      // db / api
+	Priority       int                   `json:"priority"`                  // 優先級
+	Region         string                `json:"region,omitempty"`          // 適用地區
+	CircuitBreaker *CircuitBreakerStatus `json:"circuit_breaker,omitempty"` // 斷路器狀態（未啟用時不顯示）
+	Quota          *QuotaStatus          `json:"quota,omitempty"`           // 外部 API 配額（僅外部 API）
+	Health         *ProviderHealthStatus `json:"health,omitempty"`          // 健康狀態（未啟用時不顯示）
+	Metadata       *ProviderMetadata     `json:"metadata,omitempty"`        // 資料庫中繼資料（僅本地資料庫）
+}
+
+// ProviderMetadata 本地資料庫中繼資料
+type ProviderMetadata struct {
+	DatabaseType string     `json:"database_type,omitempty"` // 例如 GeoLite2-City
+	BuildTime    *time.Time `json:"build_time,omitempty"`    // 資料庫建置時間
+	AgeDays      int        `json:"age_days"`                // 距建置時間的天數
+	Stale        bool       `json:"stale"`                   // 是否超過 geoip.stale_after
+	Languages    []string   `json:"languages,omitempty"`
+	Fields       []string   `json:"fields,omitempty"`      // 資料欄位（IPIP）
+	IPVersions   []int      `json:"ip_versions,omitempty"` // 支援的 IP 版本
+	NodeCount    uint       `json:"node_count,omitempty"`  // 搜尋樹節點數（MaxMind）
+	FilePath     string     `json:"file_path,omitempty"`
+	FileSize     int64      `json:"file_size,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"`
+	Error        string     `json:"error,omitempty"` // 讀取檔案資訊失敗的原因
+}
+
+// ProviderHealthStatus 提供者健康狀態
+type ProviderHealthStatus struct {
+	Status       string     `json:"status"`     // healthy / unhealthy
+	ErrorRate    float64    `json:"error_rate"` // 統計窗口內的錯誤率（0-1）
+	P95LatencyMs float64    `json:"p95_latency_ms"`
+	Samples      int        `json:"samples"` // 統計窗口內的樣本數
+	Since        time.Time  `json:"since"`   // 目前狀態的開始時間
+	LastError    string     `json:"last_error,omitempty"`
+	LastProbeAt  *time.Time `json:"last_probe_at,omitempty"`
+}
+
+// CircuitBreakerStatus 斷路器狀態
+type CircuitBreakerStatus struct {
+	State               string     `json:"state"` // closed / open / half-open
+	Requests            uint64     `json:"requests"`
+	Failures            uint64     `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// QuotaStatus 外部 API 配額狀態
+type QuotaStatus struct {
+	Exhausted bool                `json:"exhausted"`
+	Windows   []QuotaWindowStatus `json:"windows"`
+	Batch     *QuotaStatus        `json:"batch,omitempty"` // 批次端點另外的配額（僅 ip-api）
+}
+
+// QuotaWindowStatus 單一配額窗口狀態
+type QuotaWindowStatus struct {
+	Window    string    `json:"window"` // minute / day / month
+	Limit     int       `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// ProviderResult 單一提供者的查詢結果
+type ProviderResult struct {
+	Provider  string  `json:"provider"`
+	Kind      string  `json:"kind"` // db / api
+	Result    *IPInfo `json:"result,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs int64   `json:"latency_ms"`
+}
+
+// CompareResult 多提供者比對結果
+type CompareResult struct {
+	IP          string           `json:"ip"`
+	Results     []ProviderResult `json:"results"`
+	Agreement   AgreementSummary `json:"agreement"`
+	QueryTimeMs int64            `json:"query_time_ms"`
+}
+
+// AgreementSummary 提供者結果一致性摘要
+type AgreementSummary struct {
+	CountryMatch  bool                `json:"country_match"`             // 所有有國碼的提供者國碼一致
+	CityMatch     bool                `json:"city_match"`                // 所有有城市的提供者城市一致
+	Countries     map[string][]string `json:"countries"`                 // 國碼 -> 提供者
+	Cities        map[string][]string `json:"cities"`                    // 城市 -> 提供者
+	Distances     []ProviderDistance  `json:"distances,omitempty"`       // 兩兩提供者座標距離
+	MaxDistanceKm float64             `json:"max_distance_km,omitempty"` // 最大座標距離
+}
+
+// ProviderDistance 兩個提供者座標之間的距離
+type ProviderDistance struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// ConsensusInfo 多提供者投票結果
+type ConsensusInfo struct {
+	Country    string              `json:"country"`             // 得票最多的國碼
+	Confidence float64             `json:"confidence"`          // 得票比例（0-1）
+	Voters     int                 `json:"voters"`              // 有效投票的提供者數量
+	Votes      map[string][]string `json:"votes"`               // 國碼 -> 提供者
+	Dissenting []string            `json:"dissenting"`          // 投給其他國碼的提供者
+	Abstained  []string            `json:"abstained,omitempty"` // 查詢失敗或沒有國碼的提供者
+}
+
+// ReloadResult 重新載入資料庫的結果
+type ReloadResult struct {
+	DatasetVersion  string `json:"dataset_version"`            // 目前的資料集版本（快取命名空間）
+	PreviousVersion string `json:"previous_version,omitempty"` // 上一個使用的版本
+	Changed         bool   `json:"changed"`                    // 版本是否改變（舊快取不再使用）
+	CleanupStarted  bool   `json:"cleanup_started"`            // 是否已在背景刪除上一代快取
+	WarmupStarted   bool   `json:"warmup_started"`             // 是否已在背景預熱新的命名空間
+}
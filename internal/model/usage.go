@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// UsageReport 呼叫者的用量（帶 API 金鑰時以金鑰計算，否則以用戶端 IP 計算）
+type UsageReport struct {
+	Key          string        `json:"key,omitempty"`       // API 金鑰名稱
+	ClientIP     string        `json:"client_ip,omitempty"` // 匿名請求的用戶端 IP
+	Plan         string        `json:"plan"`                // 限流方案
+	BatchMaxSize int           `json:"batch_max_size"`      // 批次查詢最多 IP 數量
+	Windows      []UsageWindow `json:"windows"`
+}
+
+// UsageWindow 單一窗口的用量（批次查詢依 IP 數量計算）
+type UsageWindow struct {
+	Window    string     `json:"window"` // minute / hour（滑動窗口）、day / month（UTC 固定期間）
+	Limit     int        `json:"limit"`  // 0 表示不限制
+	Used      int64      `json:"used"`
+	Remaining *int64     `json:"remaining,omitempty"` // 未限制時不顯示
+	ResetAt   *time.Time `json:"reset_at,omitempty"`  // 固定期間的重設時間
+}
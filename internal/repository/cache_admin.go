@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// flushScanCount 清除快取時 SCAN 每次取回的鍵數量
+const flushScanCount = 500
+
+// CacheFilter 選擇性清除快取的條件（多個條件需同時符合）
+type CacheFilter struct {
+	Prefix   netip.Prefix // IP 落在網段內（零值表示不限）
+	Provider string       // 資料提供者
+	Source   string       // 資料來源（db / api）
+	Country  string       // 國家 ISO 代碼
+	All      bool         // 所有資料集版本的所有快取（忽略其他條件）
+}
+
+// FlushProgress 清除快取的進度（清除期間以 atomic 更新，可同時讀取）
+type FlushProgress struct {
+	Scanned int64
+	Matched int64
+	Deleted int64
+}
+
+// needsValue 是否需要讀取快取值才能判斷（提供者、來源、國家）
+func (f CacheFilter) needsValue() bool {
+	return !f.All && (f.Provider != "" || f.Source != "" || f.Country != "")
+}
+
+// scanPrefix 掃描的鍵前綴：all 掃描所有資料集版本，其他條件只掃描目前的命名空間
+func (f CacheFilter) scanPrefix(version string) string {
+	if f.All {
+		return keyPrefix
+	}
+	return versionedKey(version, "")
+}
+
+// matchKey 依鍵中的 IP 判斷網段條件
+func (f CacheFilter) matchKey(key, version string) bool {
+	if f.All || !f.Prefix.IsValid() {
+		return true
+	}
+	addr, ok := ipFromKey(key, version)
+	return ok && f.Prefix.Contains(addr)
+}
+
+// matchValue 依快取值判斷提供者、來源與國家條件（查無資料的快取不符合）
+func (f CacheFilter) matchValue(data []byte) bool {
+	if !f.needsValue() {
+		return true
+	}
+	if string(data) == notFoundMarker {
+		return false
+	}
+
+	info, err := decodeEntry(data)
+	if err != nil {
+		return false
+	}
+	if f.Provider != "" && info.Provider != f.Provider {
+		return false
+	}
+	if f.Source != "" && ResultSource(info) != f.Source {
+		return false
+	}
+	if f.Country != "" && !strings.EqualFold(info.Country.ISOCode, f.Country) {
+		return false
+	}
+	return true
+}
+
+// ipFromKey 從快取鍵取出 IP（鍵格式為 goip:country:<version>:[<mode>/]<ip>）
+func ipFromKey(key, version string) (netip.Addr, bool) {
+	rest := strings.TrimPrefix(key, versionedKey(version, ""))
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		rest = rest[i+1:]
+	}
+
+	addr, err := netip.ParseAddr(rest)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// describeEntry 將快取值轉為詳細資訊
+func describeEntry(stale StalePolicy, key string, data []byte, notFound bool, remaining time.Duration) (*model.CacheEntryDetail, error) {
+	detail := &model.CacheEntryDetail{
+		Key:        key,
+		NotFound:   notFound,
+		TTLSeconds: -1,
+		SizeBytes:  len(data),
+	}
+	if remaining >= 0 {
+		detail.TTLSeconds = int64(remaining / time.Second)
+	}
+	if notFound {
+		return detail, nil
+	}
+
+	info, meta, err := decodeEntryMeta(data)
+	if err != nil {
+		return nil, err
+	}
+
+	source := ResultSource(info)
+	detail.Freshness = stale.freshness(source, remaining).String()
+	detail.Provider = info.Provider
+	detail.Source = source
+	detail.CachedAt = info.CachedAt
+	detail.DatasetVersion = meta.datasetVersion
+	detail.Schema = meta.schema
+	detail.Compressed = meta.compressed
+	detail.Info = info
+	return detail, nil
+}
+
+// Inspect 取得目前命名空間中單一快取項目的詳細資訊，不存在時回傳 ErrCacheMiss
+func (r *cacheRepository) Inspect(ctx context.Context, ip string) (*model.CacheEntryDetail, error) {
+	key := r.key(ip)
+
+	pipe := r.client.Pipeline()
+	getCmd := pipe.Get(ctx, key)
+	ttlCmd := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if err == redis.Nil {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+
+	val := getCmd.Val()
+	return describeEntry(r.stale, key, []byte(val), val == notFoundMarker, ttlCmd.Val())
+}
+
+// FlushMatching 以 SCAN 逐批找出符合條件的快取並刪除（cluster 模式逐一 master 節點），不會阻塞 Redis
+func (r *cacheRepository) FlushMatching(ctx context.Context, filter CacheFilter, progress *FlushProgress) error {
+	version := r.DatasetVersion()
+	pattern := filter.scanPrefix(version) + "*"
+
+	return forEachShard(ctx, r.client, func(ctx context.Context, shard redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			keys, next, err := shard.Scan(ctx, cursor, pattern, flushScanCount).Result()
+			if err != nil {
+				return err
+			}
+			atomic.AddInt64(&progress.Scanned, int64(len(keys)))
+
+			matched, err := matchKeys(ctx, shard, keys, filter, version)
+			if err != nil {
+				return err
+			}
+			atomic.AddInt64(&progress.Matched, int64(len(matched)))
+
+			deleted, err := deleteKeys(ctx, shard, matched)
+			atomic.AddInt64(&progress.Deleted, deleted)
+			if err != nil {
+				return err
+			}
+
+			cursor = next
+			if cursor == 0 {
+				return nil
+			}
+		}
+	})
+}
+
+// matchKeys 篩選符合條件的鍵，需要時以 pipeline 讀取快取值
+func matchKeys(ctx context.Context, client redis.UniversalClient, keys []string, filter CacheFilter, version string) ([]string, error) {
+	var candidates []string
+	for _, key := range keys {
+		if filter.matchKey(key, version) {
+			candidates = append(candidates, key)
+		}
+	}
+	if !filter.needsValue() || len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(candidates))
+	for i, key := range candidates {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	// 掃描後已過期的鍵回傳 redis.Nil
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var matched []string
+	for i, cmd := range cmds {
+		if data, err := cmd.Bytes(); err == nil && filter.matchValue(data) {
+			matched = append(matched, candidates[i])
+		}
+	}
+	return matched, nil
+}
+
+// Inspect 取得目前命名空間中單一快取項目的詳細資訊，不存在時回傳 ErrCacheMiss
+func (r *memoryCacheRepository) Inspect(ctx context.Context, ip string) (*model.CacheEntryDetail, error) {
+	key := r.key(ip)
+	item, remaining, ok := r.load(key, time.Now())
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return describeEntry(r.stale, key, item.data, item.data == nil, remaining)
+}
+
+// FlushMatching 刪除符合條件的快取
+func (r *memoryCacheRepository) FlushMatching(ctx context.Context, filter CacheFilter, progress *FlushProgress) error {
+	version := r.DatasetVersion()
+	prefix := filter.scanPrefix(version)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, elem := range r.items {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		atomic.AddInt64(&progress.Scanned, 1)
+
+		item := elem.Value.(*memoryCacheItem)
+		if !filter.matchKey(key, version) || !filter.matchValue(item.data) {
+			continue
+		}
+		atomic.AddInt64(&progress.Matched, 1)
+
+		r.remove(elem)
+		atomic.AddInt64(&progress.Deleted, 1)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/ugorji/go/codec"
+)
+
+// 快取值格式：
+//   - 舊版（schema 0）：JSON 編碼的 model.IPInfo，以 '{' 開頭
+//   - schema 1：[schema 版本 1 byte][flags 1 byte][msgpack 編碼的 cacheEnvelope，可能以 flate 壓縮]
+const (
+	cacheSchemaVersion byte = 1
+
+	// flagCompressed payload 以 flate 壓縮
+	flagCompressed byte = 1 << 0
+
+	// compressThreshold payload 超過此大小才嘗試壓縮，太小的資料壓縮後反而變大
+	compressThreshold = 256
+)
+
+var (
+	ErrCacheDecode = errors.New("cannot decode cached entry")
+)
+
+// cacheEnvelope 快取項目外層，Info 不含 provider、source、query_time_ms、cached_at 等每次請求的欄位
+type cacheEnvelope struct {
+	CachedAt       int64         `codec:"t"`           // 寫入時間（Unix 毫秒）
+	Provider       string        `codec:"p"`           // 資料提供者
+	DatasetVersion string        `codec:"d,omitempty"` // 寫入時的資料集版本
+	Info           *model.IPInfo `codec:"i"`
+}
+
+// msgpackHandle msgpack 編碼設定（IPInfo 沿用 json 標籤作為欄位名稱，新增欄位時仍可解碼舊資料）
+var msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+
+// encodeEntry 將查詢結果編碼為快取值
+func encodeEntry(info *model.IPInfo, datasetVersion string, compress bool, now time.Time) ([]byte, error) {
+	stored := *info
+	stored.Provider = ""
+	stored.Source = ""
+	stored.QueryTimeMs = 0
+	stored.CachedAt = nil
+
+	envelope := cacheEnvelope{
+		CachedAt:       now.UnixMilli(),
+		Provider:       info.Provider,
+		DatasetVersion: datasetVersion,
+		Info:           &stored,
+	}
+
+	var payload []byte
+	if err := codec.NewEncoderBytes(&payload, msgpackHandle).Encode(&envelope); err != nil {
+		return nil, err
+	}
+
+	flags := byte(0)
+	if compress && len(payload) >= compressThreshold {
+		if compressed, err := deflate(payload); err == nil && len(compressed) < len(payload) {
+			payload = compressed
+			flags |= flagCompressed
+		}
+	}
+
+	return append([]byte{cacheSchemaVersion, flags}, payload...), nil
+}
+
+// entryMeta 快取值的格式資訊
+type entryMeta struct {
+	schema         int    // 0 為舊版 JSON
+	compressed     bool   // payload 是否以 flate 壓縮
+	datasetVersion string // 寫入時的資料集版本（舊版 JSON 沒有記錄）
+}
+
+// decodeEntry 解碼快取值，支援舊版 JSON 格式；無法解碼時回傳 ErrCacheDecode
+func decodeEntry(data []byte) (*model.IPInfo, error) {
+	info, _, err := decodeEntryMeta(data)
+	return info, err
+}
+
+// decodeEntryMeta 解碼快取值並回傳格式資訊
+func decodeEntryMeta(data []byte) (*model.IPInfo, entryMeta, error) {
+	var meta entryMeta
+	if len(data) == 0 {
+		return nil, meta, fmt.Errorf("%w: empty value", ErrCacheDecode)
+	}
+
+	switch data[0] {
+	case '{':
+		var info model.IPInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, meta, fmt.Errorf("%w: %v", ErrCacheDecode, err)
+		}
+		info.Source = ""
+		info.QueryTimeMs = 0
+		return &info, meta, nil
+
+	case cacheSchemaVersion:
+		if len(data) < 2 {
+			return nil, meta, fmt.Errorf("%w: truncated header", ErrCacheDecode)
+		}
+
+		meta.schema = int(cacheSchemaVersion)
+		payload := data[2:]
+		if data[1]&flagCompressed != 0 {
+			meta.compressed = true
+			inflated, err := inflate(payload)
+			if err != nil {
+				return nil, meta, fmt.Errorf("%w: %v", ErrCacheDecode, err)
+			}
+			payload = inflated
+		}
+
+		var envelope cacheEnvelope
+		if err := codec.NewDecoderBytes(payload, msgpackHandle).Decode(&envelope); err != nil {
+			return nil, meta, fmt.Errorf("%w: %v", ErrCacheDecode, err)
+		}
+		if envelope.Info == nil {
+			return nil, meta, fmt.Errorf("%w: missing result", ErrCacheDecode)
+		}
+
+		meta.datasetVersion = envelope.DatasetVersion
+		info := envelope.Info
+		info.Provider = envelope.Provider
+		cachedAt := time.UnixMilli(envelope.CachedAt)
+		info.CachedAt = &cachedAt
+		return info, meta, nil
+
+	default:
+		return nil, meta, fmt.Errorf("%w: unsupported schema version %d", ErrCacheDecode, data[0])
+	}
+}
+
+// deflate 以 flate 壓縮資料
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflate 解壓縮 flate 資料
+func inflate(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return io.ReadAll(r)
+}
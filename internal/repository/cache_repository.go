@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shengjhe/goip/internal/model"
@@ -12,93 +14,234 @@ import (
 
 const (
 	keyPrefix = "goip:country:"
+
+	// datasetVersionKey 記錄目前使用的資料集版本，重啟後可找出上一代快取
+	datasetVersionKey = "goip:cache:dataset_version"
+
+	// notFoundMarker 查無資料的快取值（非 JSON，不會與正常結果混淆）
+	notFoundMarker = "!notfound"
 )
 
-// CacheRepository Redis 快取存取介面
+var (
+	ErrCacheMiss     = errors.New("cache miss")
+	ErrNegativeCache = fmt.Errorf("cached as not found: %w", ErrIPNotFound)
+)
+
+// CacheEntry 快取項目
+type CacheEntry struct {
+	Info      *model.IPInfo // nil 表示快取為查無資料（只出現在 MGet）
+	Freshness Freshness
+}
+
+// CacheRepository 快取存取介面（Redis、記憶體或不快取）
+// Set / MSet 的 ttl 為 soft TTL，實際過期時間會依資料來源加上 stale 區間
 type CacheRepository interface {
-	Get(ctx context.Context, ip string) (*model.IPInfo, error)
+	// Get 未命中時回傳 ErrCacheMiss
+	Get(ctx context.Context, ip string) (*CacheEntry, error)
 	Set(ctx context.Context, ip string, info *model.IPInfo, ttl time.Duration) error
-	MGet(ctx context.Context, ips []string) (map[string]*model.IPInfo, error)
+	SetNotFound(ctx context.Context, ip string, ttl time.Duration) error
+	MGet(ctx context.Context, ips []string) (map[string]*CacheEntry, error)
 	MSet(ctx context.Context, items map[string]*model.IPInfo, ttl time.Duration) error
 	Delete(ctx context.Context, ips ...string) error
+
+	// UseDatasetVersion 切換到資料集版本的命名空間，回傳上一個使用的版本（跨重啟保留）
+	UseDatasetVersion(ctx context.Context, version string) (string, error)
+	// DatasetVersion 目前使用的資料集版本
+	DatasetVersion() string
+	// DeleteDatasetVersion 刪除指定資料集版本的所有快取，回傳刪除的鍵數量
+	DeleteDatasetVersion(ctx context.Context, version string) (int64, error)
+
+	// IncrHotIPs 累加 IP 的查詢次數（供快取預熱使用，不受清除快取與資料集版本切換影響）
+	IncrHotIPs(ctx context.Context, counts map[string]float64) error
+	// HotIPs 查詢次數最多的 IP（由多到少）
+	HotIPs(ctx context.Context, limit int) ([]string, error)
+
+	// Inspect 取得目前命名空間中單一快取項目的詳細資訊，不存在時回傳 ErrCacheMiss
+	Inspect(ctx context.Context, ip string) (*model.CacheEntryDetail, error)
+	// FlushMatching 刪除符合條件的快取，進度即時寫入 progress
+	FlushMatching(ctx context.Context, filter CacheFilter, progress *FlushProgress) error
+
 	Exists(ctx context.Context, ip string) (bool, error)
 	FlushAll(ctx context.Context) error
 	GetStats(ctx context.Context) (*model.CacheStats, error)
 	Close() error
 	HealthCheck(ctx context.Context) error
+	// Backend 快取後端名稱：redis / memory / none
+	Backend() string
+}
+
+// CacheOptions Cache repository 選項
+type CacheOptions struct {
+	Stale      StalePolicy // stale-while-revalidate 策略
+	Compress   bool        // 較大的快取值以 flate 壓縮
+	MaxEntries int         // 最大項目數（只用於記憶體快取，超過時淘汰最久未使用的項目）
 }
 
 type cacheRepository struct {
-	client *redis.Client
+	client   redis.UniversalClient
+	stale    StalePolicy
+	compress bool
+
+	mu      sync.RWMutex
+	version string // 資料集版本，快取鍵為 goip:country:<version>:<ip>
+
+	counters cacheCounters
 }
 
-// NewCacheRepository 建立新的 Cache repository
-func NewCacheRepository(client *redis.Client) CacheRepository {
+// NewCacheRepository 建立新的 Cache repository（支援 standalone / sentinel / cluster 客戶端）
+// 快取鍵不使用 hash tag，讓不同 IP 分散到所有 slot；批次操作使用 pipeline，
+// cluster 模式下由客戶端依 slot 分組送到對應節點
+func NewCacheRepository(client redis.UniversalClient, opts CacheOptions) CacheRepository {
 	return &cacheRepository{
-		client: client,
+		client:   client,
+		stale:    opts.Stale,
+		compress: opts.Compress,
+	}
+}
+
+// key 產生目前資料集版本的快取鍵
+func (r *cacheRepository) key(ip string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return versionedKey(r.version, ip)
+}
+
+// versionedKey 產生資料集版本的快取鍵（沒有版本時使用不分版本的命名空間）
+func versionedKey(version, ip string) string {
+	if version == "" {
+		return keyPrefix + ip
 	}
+	return keyPrefix + version + ":" + ip
 }
 
-// Get 獲取單一快取
-func (r *cacheRepository) Get(ctx context.Context, ip string) (*model.IPInfo, error) {
-	key := keyPrefix + ip
-	val, err := r.client.Get(ctx, key).Result()
+// UseDatasetVersion 切換到資料集版本的命名空間，新的查詢立即使用新命名空間，舊的快取依 TTL 自然過期
+func (r *cacheRepository) UseDatasetVersion(ctx context.Context, version string) (string, error) {
+	r.mu.Lock()
+	r.version = version
+	r.mu.Unlock()
+
+	previous, err := r.client.GetSet(ctx, datasetVersionKey, version).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return previous, err
+}
+
+// DatasetVersion 目前使用的資料集版本
+func (r *cacheRepository) DatasetVersion() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// DeleteDatasetVersion 刪除指定資料集版本的所有快取（不分版本的命名空間無法單獨刪除）
+func (r *cacheRepository) DeleteDatasetVersion(ctx context.Context, version string) (int64, error) {
+	if version == "" {
+		return 0, nil
+	}
+	return r.deleteMatching(ctx, keyPrefix+version+":*")
+}
+
+// Get 獲取單一快取（含新鮮度），未命中時回傳 ErrCacheMiss，快取為查無資料時回傳 ErrNegativeCache
+func (r *cacheRepository) Get(ctx context.Context, ip string) (*CacheEntry, error) {
+	key := r.key(ip)
+
+	start := time.Now()
+	pipe := r.client.Pipeline()
+	getCmd := pipe.Get(ctx, key)
+	ttlCmd := pipe.PTTL(ctx, key)
+	_, err := pipe.Exec(ctx)
+	r.counters.observe(start)
 	if err != nil {
+		if err == redis.Nil {
+			r.counters.record(0, 1)
+			return nil, ErrCacheMiss
+		}
+		r.counters.fail()
 		return nil, err
 	}
 
-	var info model.IPInfo
-	if err := json.Unmarshal([]byte(val), &info); err != nil {
+	val := getCmd.Val()
+	if val == notFoundMarker {
+		r.counters.record(1, 0)
+		return nil, ErrNegativeCache
+	}
+
+	info, err := decodeEntry([]byte(val))
+	if err != nil {
+		r.counters.record(0, 1)
 		return nil, err
 	}
 
-	return &info, nil
+	r.counters.record(1, 0)
+	return &CacheEntry{
+		Info:      info,
+		Freshness: r.stale.freshness(ResultSource(info), ttlCmd.Val()),
+	}, nil
 }
 
 // Set 設定快取
 func (r *cacheRepository) Set(ctx context.Context, ip string, info *model.IPInfo, ttl time.Duration) error {
-	key := keyPrefix + ip
-	data, err := json.Marshal(info)
+	key := r.key(ip)
+	data, err := encodeEntry(info, r.DatasetVersion(), r.compress, time.Now())
 	if err != nil {
 		return err
 	}
 
-	return r.client.Set(ctx, key, data, ttl).Err()
+	return r.track(time.Now(), r.client.Set(ctx, key, data, r.stale.hardTTL(ResultSource(info), ttl)).Err())
+}
+
+// SetNotFound 快取查無資料的結果（應使用比正常結果短的 TTL）
+func (r *cacheRepository) SetNotFound(ctx context.Context, ip string, ttl time.Duration) error {
+	return r.track(time.Now(), r.client.Set(ctx, r.key(ip), notFoundMarker, ttl).Err())
 }
 
-// MGet 批次獲取多個快取
-func (r *cacheRepository) MGet(ctx context.Context, ips []string) (map[string]*model.IPInfo, error) {
+// MGet 批次獲取多個快取（含新鮮度），快取為查無資料的 IP 對應 Info 為 nil
+func (r *cacheRepository) MGet(ctx context.Context, ips []string) (map[string]*CacheEntry, error) {
 	if len(ips) == 0 {
-		return make(map[string]*model.IPInfo), nil
+		return make(map[string]*CacheEntry), nil
 	}
 
 	pipe := r.client.Pipeline()
 
 	// 批次查詢
 	cmds := make([]*redis.StringCmd, len(ips))
+	ttlCmds := make([]*redis.DurationCmd, len(ips))
 	for i, ip := range ips {
-		key := keyPrefix + ip
+		key := r.key(ip)
 		cmds[i] = pipe.Get(ctx, key)
+		ttlCmds[i] = pipe.PTTL(ctx, key)
 	}
 
+	start := time.Now()
 	_, err := pipe.Exec(ctx)
+	r.counters.observe(start)
 	// 忽略 redis.Nil 錯誤（部分鍵不存在是正常的）
 	if err != nil && err != redis.Nil {
+		r.counters.fail()
 		return nil, err
 	}
 
-	// 解析結果
-	results := make(map[string]*model.IPInfo)
+	// 解析結果（無法解碼的項目視為未命中，查詢後會以新格式覆寫）
+	results := make(map[string]*CacheEntry)
 	for i, cmd := range cmds {
 		val, err := cmd.Result()
-		if err == nil {
-			var info model.IPInfo
-			if json.Unmarshal([]byte(val), &info) == nil {
-				results[ips[i]] = &info
+		if err != nil {
+			continue
+		}
+		if val == notFoundMarker {
+			results[ips[i]] = &CacheEntry{}
+			continue
+		}
+		if info, err := decodeEntry([]byte(val)); err == nil {
+			results[ips[i]] = &CacheEntry{
+				Info:      info,
+				Freshness: r.stale.freshness(ResultSource(info), ttlCmds[i].Val()),
 			}
 		}
 	}
 
+	r.counters.record(len(results), len(ips)-len(results))
 	return results, nil
 }
 
@@ -109,102 +252,135 @@ func (r *cacheRepository) MSet(ctx context.Context, items map[string]*model.IPIn
 	}
 
 	pipe := r.client.Pipeline()
+	version := r.DatasetVersion()
+	now := time.Now()
 
 	for ip, info := range items {
-		key := keyPrefix + ip
-		data, err := json.Marshal(info)
+		key := r.key(ip)
+		data, err := encodeEntry(info, version, r.compress, now)
 		if err != nil {
 			continue
 		}
-		pipe.Set(ctx, key, data, ttl)
+		pipe.Set(ctx, key, data, r.stale.hardTTL(ResultSource(info), ttl))
 	}
 
+	start := time.Now()
 	_, err := pipe.Exec(ctx)
+	return r.track(start, err)
+}
+
+// track 記錄寫入的 Redis 往返時間與錯誤，回傳原本的錯誤
+func (r *cacheRepository) track(start time.Time, err error) error {
+	r.counters.observe(start)
+	if err != nil {
+		r.counters.fail()
+	}
 	return err
 }
 
 // Delete 刪除快取
+// 鍵可能分屬不同 slot（例如不同查詢範圍），因此以 pipeline 逐鍵刪除，避免 cluster 的 CROSSSLOT 錯誤
 func (r *cacheRepository) Delete(ctx context.Context, ips ...string) error {
-	if len(ips) == 0 {
-		return nil
-	}
-
 	keys := make([]string, len(ips))
 	for i, ip := range ips {
-		keys[i] = keyPrefix + ip
+		keys[i] = r.key(ip)
 	}
 
-	return r.client.Del(ctx, keys...).Err()
+	_, err := deleteKeys(ctx, r.client, keys)
+	return err
 }
 
 // Exists 檢查快取是否存在
 func (r *cacheRepository) Exists(ctx context.Context, ip string) (bool, error) {
-	key := keyPrefix + ip
+	key := r.key(ip)
 	count, err := r.client.Exists(ctx, key).Result()
 	return count > 0, err
 }
 
-// FlushAll 清空所有快取（謹慎使用）
+// FlushAll 清空所有快取（包含所有資料集版本，謹慎使用）
 func (r *cacheRepository) FlushAll(ctx context.Context) error {
 	// 只刪除符合前綴的鍵
-	iter := r.client.Scan(ctx, 0, keyPrefix+"*", 0).Iterator()
-	var keys []string
-
-	for iter.Next(ctx) {
-		keys = append(keys, iter.Val())
-		// 批次刪除，避免一次刪除太多
-		if len(keys) >= 1000 {
-			if err := r.client.Del(ctx, keys...).Err(); err != nil {
-				return err
-			}
-			keys = keys[:0]
-		}
-	}
-
-	if err := iter.Err(); err != nil {
-		return err
-	}
-
-	// 刪除剩餘的鍵
-	if len(keys) > 0 {
-		return r.client.Del(ctx, keys...).Err()
-	}
+	_, err := r.deleteMatching(ctx, keyPrefix+"*")
+	return err
+}
 
-	return nil
+// deleteMatching 在所有節點刪除符合 pattern 的鍵，回傳刪除數量
+func (r *cacheRepository) deleteMatching(ctx context.Context, pattern string) (int64, error) {
+	return ScanDelete(ctx, r.client, pattern)
 }
 
 // GetStats 獲取快取統計
+// 鍵數量以 DBSIZE 與 RANDOMKEY 抽樣估算，不掃描整個 keyspace；cluster 模式彙總所有 master 節點
 func (r *cacheRepository) GetStats(ctx context.Context) (*model.CacheStats, error) {
 	// 獲取連線池統計
 	poolStats := r.client.PoolStats()
 
-	// 獲取 Redis INFO 統計
-	info, err := r.client.Info(ctx, "stats", "memory").Result()
-	if err != nil {
-		return nil, err
+	hits := atomic.LoadUint64(&r.counters.hits)
+	misses := atomic.LoadUint64(&r.counters.misses)
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
 	}
 
 	stats := &model.CacheStats{
+		Backend:      "redis",
 		PoolHits:     uint64(poolStats.Hits),
 		PoolMisses:   uint64(poolStats.Misses),
 		PoolTimeouts: uint64(poolStats.Timeouts),
+		CacheHits:    hits,
+		CacheMisses:  misses,
+		CacheErrors:  atomic.LoadUint64(&r.counters.errors),
+		HitRate:      hitRate,
+		AvgLatency:   r.counters.avgLatencyMs(),
+
+		DatasetVersion: r.DatasetVersion(),
 	}
 
-	// 解析 INFO 輸出（簡化版，實際應更詳細解析）
-	// 這裡僅為示範，實際可使用更完整的解析邏輯
-	fmt.Sscanf(info, "used_memory:%d", &stats.UsedMemory)
+	var mu sync.Mutex
+	err := forEachShard(ctx, r.client, func(ctx context.Context, shard redis.UniversalClient) error {
+		pipe := shard.Pipeline()
+		infoCmd := pipe.Info(ctx, "stats", "memory")
+		dbSizeCmd := pipe.DBSize(ctx)
+		sampleCmds := make([]*redis.StringCmd, keyCountSamples)
+		for i := range sampleCmds {
+			sampleCmds[i] = pipe.RandomKey(ctx)
+		}
+		// 資料庫為空時 RANDOMKEY 回傳 redis.Nil
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+
+		info := parseRedisInfo(infoCmd.Val())
+		dbSize := dbSizeCmd.Val()
 
-	// 獲取鍵數量（符合前綴的）
-	iter := r.client.Scan(ctx, 0, keyPrefix+"*", 0).Iterator()
-	count := uint64(0)
-	for iter.Next(ctx) {
-		count++
+		var samples []string
+		for _, cmd := range sampleCmds {
+			if key, err := cmd.Result(); err == nil {
+				samples = append(samples, key)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		stats.UsedMemory += infoUint(info, "used_memory")
+		stats.EvictedKeys += infoUint(info, "evicted_keys")
+		stats.ExpiredKeys += infoUint(info, "expired_keys")
+		stats.DBKeys += uint64(dbSize)
+		stats.KeyCount += estimateKeyCount(dbSize, samples, keyPrefix)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	stats.KeyCount = count
 
 	return stats, nil
 }
 
+// Backend 快取後端名稱
+func (r *cacheRepository) Backend() string {
+	return "redis"
+}
+
 // Close 關閉連接
 func (r *cacheRepository) Close() error {
 	return r.client.Close()
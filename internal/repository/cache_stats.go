@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// keyCountSamples 估算快取鍵數量時以 RANDOMKEY 抽樣的次數
+const keyCountSamples = 50
+
+// cacheCounters 快取存取統計（只計算此實例的存取，不含其他共用 Redis 的實例）
+type cacheCounters struct {
+	hits      uint64
+	misses    uint64
+	errors    uint64
+	latencyNs uint64 // Redis 往返時間總和
+	calls     uint64
+}
+
+// observe 記錄一次 Redis 往返時間，使用方式：defer r.counters.observe(time.Now())
+func (c *cacheCounters) observe(start time.Time) {
+	atomic.AddUint64(&c.latencyNs, uint64(time.Since(start)))
+	atomic.AddUint64(&c.calls, 1)
+}
+
+// record 記錄命中、未命中次數
+func (c *cacheCounters) record(hits, misses int) {
+	atomic.AddUint64(&c.hits, uint64(hits))
+	atomic.AddUint64(&c.misses, uint64(misses))
+}
+
+// fail 記錄一次 Redis 錯誤
+func (c *cacheCounters) fail() {
+	atomic.AddUint64(&c.errors, 1)
+}
+
+// avgLatencyMs 平均 Redis 往返時間（毫秒）
+func (c *cacheCounters) avgLatencyMs() float64 {
+	calls := atomic.LoadUint64(&c.calls)
+	if calls == 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&c.latencyNs)) / float64(calls) / float64(time.Millisecond)
+}
+
+// parseRedisInfo 解析 INFO 輸出為 field -> value（忽略 section 標題與空行）
+func parseRedisInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// infoUint 讀取 INFO 欄位的整數值，不存在或格式錯誤時回傳 0
+func infoUint(fields map[string]string, name string) uint64 {
+	v, err := strconv.ParseUint(fields[name], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// estimateKeyCount 依抽樣中符合前綴的比例估算快取鍵數量
+func estimateKeyCount(dbSize int64, samples []string, prefix string) uint64 {
+	if dbSize <= 0 || len(samples) == 0 {
+		return 0
+	}
+
+	matched := 0
+	for _, key := range samples {
+		if strings.HasPrefix(key, prefix) {
+			matched++
+		}
+	}
+	return uint64(float64(dbSize) * float64(matched) / float64(len(samples)))
+}
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+var (
+	ErrCircuitOpen = errors.New("provider circuit breaker is open")
+)
+
+// CircuitState 斷路器狀態
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String 回傳狀態名稱
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerSettings 斷路器參數
+type CircuitBreakerSettings struct {
+	ConsecutiveFailures int           // 連續失敗幾次後斷開（0 表示不使用）
+	FailureRatio        float64       // 統計窗口內失敗比例超過此值時斷開（0 表示不使用）
+	MinRequests         int           // 計算失敗比例前的最少請求數
+	Window              time.Duration // closed 狀態下的統計窗口
+	CoolDown            time.Duration // open 狀態維持多久後進入 half-open
+	HalfOpenRequests    int           // half-open 狀態允許的探測請求數
+}
+
+// CircuitBreaker 單一提供者的斷路器
+type CircuitBreaker struct {
+	name     string
+	settings CircuitBreakerSettings
+
+	mu                  sync.Mutex
+	state               CircuitState
+	windowStart         time.Time
+	requests            uint64
+	failures            uint64
+	consecutiveFailures int
+	openedAt            time.Time
+	halfOpenInFlight    int
+	halfOpenSuccesses   int
+}
+
+// NewCircuitBreaker 建立新的斷路器
+func NewCircuitBreaker(name string, settings CircuitBreakerSettings) *CircuitBreaker {
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = 30 * time.Second
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+
+	return &CircuitBreaker{
+		name:        name,
+		settings:    settings,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+	}
+}
+
+// Allow 判斷是否允許請求通過
+// 回傳 true 時，呼叫端必須在請求結束後呼叫 RecordSuccess、RecordFailure 或 Release
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+
+	switch cb.state {
+	case CircuitOpen:
+		if now.Sub(cb.openedAt) < cb.settings.CoolDown {
+			return false
+		}
+		// 冷卻時間已過，進入 half-open 開始探測
+		cb.setState(CircuitHalfOpen, now)
+		fallthrough
+
+	case CircuitHalfOpen:
+		if cb.halfOpenInFlight >= cb.settings.HalfOpenRequests {
+			return false
+		}
+		cb.halfOpenInFlight++
+		return true
+
+	default:
+		if cb.settings.Window > 0 && now.Sub(cb.windowStart) >= cb.settings.Window {
+			cb.resetCounts(now)
+		}
+		return true
+	}
+}
+
+// RecordSuccess 記錄成功（包含提供者正常回應「查無資料」）
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		cb.releaseProbe()
+		cb.halfOpenSuccesses++
+		if cb.halfOpenSuccesses >= cb.settings.HalfOpenRequests {
+			cb.setState(CircuitClosed, time.Now())
+		}
+
+	case CircuitClosed:
+		cb.requests++
+		cb.consecutiveFailures = 0
+	}
+}
+
+// Release 請求沒有得到提供者的回應（例如本地配額用盡、呼叫端取消），
+// 只釋放 half-open 探測名額，不計入成功或失敗
+func (cb *CircuitBreaker) Release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.releaseProbe()
+	}
+}
+
+// RecordFailure 記錄失敗
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		// 探測失敗，重新斷開
+		cb.releaseProbe()
+		cb.setState(CircuitOpen, now)
+
+	case CircuitClosed:
+		cb.requests++
+		cb.failures++
+		cb.consecutiveFailures++
+		if cb.shouldTrip() {
+			cb.setState(CircuitOpen, now)
+		}
+	}
+}
+
+// State 取得目前狀態
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.settings.CoolDown {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// Status 取得斷路器狀態快照
+func (cb *CircuitBreaker) Status() *model.CircuitBreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := &model.CircuitBreakerStatus{
+		State:               cb.state.String(),
+		Requests:            cb.requests,
+		Failures:            cb.failures,
+		ConsecutiveFailures: cb.consecutiveFailures,
+	}
+
+	if cb.state == CircuitOpen {
+		openedAt := cb.openedAt
+		retryAt := cb.openedAt.Add(cb.settings.CoolDown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+		if !time.Now().Before(retryAt) {
+			status.State = CircuitHalfOpen.String()
+		}
+	}
+
+	return status
+}
+
+// shouldTrip 判斷是否需要斷開（需持有鎖）
+func (cb *CircuitBreaker) shouldTrip() bool {
+	if cb.settings.ConsecutiveFailures > 0 && cb.consecutiveFailures >= cb.settings.ConsecutiveFailures {
+		return true
+	}
+
+	if cb.settings.FailureRatio > 0 && cb.requests >= uint64(cb.settings.MinRequests) {
+		ratio := float64(cb.failures) / float64(cb.requests)
+		if ratio >= cb.settings.FailureRatio {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setState 切換狀態並重置計數（需持有鎖）
+func (cb *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	cb.state = state
+	cb.halfOpenInFlight = 0
+	cb.halfOpenSuccesses = 0
+
+	switch state {
+	case CircuitOpen:
+		cb.openedAt = now
+	case CircuitClosed:
+		cb.resetCounts(now)
+	}
+}
+
+// resetCounts 重置統計窗口（需持有鎖）
+func (cb *CircuitBreaker) resetCounts(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutiveFailures = 0
+}
+
+// releaseProbe 釋放 half-open 探測名額（需持有鎖）
+func (cb *CircuitBreaker) releaseProbe() {
+	if cb.halfOpenInFlight > 0 {
+		cb.halfOpenInFlight--
+	}
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+// ConsensusOptions 投票模式選項
+type ConsensusOptions struct {
+	IncludeExternal bool // 外部 API 是否參與投票（會消耗配額）
+}
+
+// LookupConsensus 投票模式查詢：並行查詢所有本地資料庫（可選擇包含外部 API），
+// 以 ISO 國碼投票，回傳得票最多國家中優先級最高的提供者結果，並附上信心分數與反對的提供者
+// 同票時以優先級較高的提供者所投的國家為準；沒有 ISO 國碼的結果（例如 IPIP 免費版）視為棄權
+func (r *MultiProviderRepository) LookupConsensus(ctx context.Context, ipStr string) (*model.IPInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if net.ParseIP(ipStr) == nil {
+		return nil, ErrInvalidIP
+	}
+
+	voters := make([]*ProviderInfo, 0, len(r.providers))
+	for i := range r.providers {
+		if !r.consensus.IncludeExternal && IsExternalAPI(r.providers[i].Provider.GetProviderType()) {
+			continue
+		}
+		voters = append(voters, &r.providers[i])
+	}
+
+	consensus := &model.ConsensusInfo{
+		Votes:      make(map[string][]string),
+		Dissenting: []string{},
+	}
+	records := make(map[string]*model.IPInfo) // 國碼 -> 優先級最高的結果
+	var order []string                        // 國碼依首次得票順序（即優先級）排列
+
+	results, errs := r.lookupConcurrent(ctx, ipStr, voters)
+	notFound := len(voters) > 0 // 所有投票者都明確回報查無資料（斷路器開啟、配額用盡、逾時等不算）
+	for i, result := range results {
+		if errs[i] == nil || !IsNotFound(errs[i]) {
+			notFound = false
+		}
+		if result.Result == nil || result.Result.Country.ISOCode == "" {
+			consensus.Abstained = append(consensus.Abstained, result.Provider)
+			continue
+		}
+
+		code := strings.ToUpper(result.Result.Country.ISOCode)
+		if _, ok := records[code]; !ok {
+			records[code] = result.Result
+			order = append(order, code)
+		}
+		consensus.Votes[code] = append(consensus.Votes[code], result.Provider)
+		consensus.Voters++
+	}
+
+	if consensus.Voters == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if notFound {
+			return nil, ErrIPNotFound
+		}
+		return nil, ErrAllFailed
+	}
+
+	winner := order[0]
+	for _, code := range order[1:] {
+		if len(consensus.Votes[code]) > len(consensus.Votes[winner]) {
+			winner = code
+		}
+	}
+
+	for _, code := range order {
+		if code != winner {
+			consensus.Dissenting = append(consensus.Dissenting, consensus.Votes[code]...)
+		}
+	}
+
+	ratio := float64(len(consensus.Votes[winner])) / float64(consensus.Voters)
+	consensus.Country = winner
+	consensus.Confidence = math.Round(ratio*100) / 100
+
+	info := records[winner]
+	info.Consensus = consensus
+	return info, nil
+}
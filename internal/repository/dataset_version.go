@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// localProviders 取得本地資料庫提供者（多提供者時逐一展開）
+func localProviders(repo GeoIPRepository) []GeoIPRepository {
+	multi, ok := repo.(*MultiProviderRepository)
+	if !ok {
+		if _, isFile := repo.(FileProvider); isFile {
+			return []GeoIPRepository{repo}
+		}
+		return nil
+	}
+
+	multi.mu.RLock()
+	defer multi.mu.RUnlock()
+
+	var providers []GeoIPRepository
+	for _, p := range multi.providers {
+		if _, isFile := p.Provider.(FileProvider); isFile {
+			providers = append(providers, p.Provider)
+		}
+	}
+	return providers
+}
+
+// DatasetVersion 依本地資料庫的建置時間產生資料集版本，作為快取命名空間
+// 任一資料庫更新後版本即改變；沒有本地資料庫時回傳空字串（使用不分版本的命名空間）
+func DatasetVersion(repo GeoIPRepository) string {
+	var parts []string
+	for _, provider := range localProviders(repo) {
+		metadata := DescribeProvider(provider)
+		if metadata == nil || metadata.BuildTime == nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d", provider.GetProviderType(), metadata.BuildTime.Unix()))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	sort.Strings(parts)
+	sum := sha256.Sum256([]byte(strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:4])
+}
+
+// ReloadDatabases 從目前的檔案路徑重新載入所有本地資料庫（用於資料庫檔案更新後）
+func ReloadDatabases(repo GeoIPRepository) error {
+	var errs []error
+	for _, provider := range localProviders(repo) {
+		path := provider.(FileProvider).DBPath()
+		if err := provider.Reload(path); err != nil {
+			errs = append(errs, fmt.Errorf("reload %s: %w", provider.GetProviderType(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
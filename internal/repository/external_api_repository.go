@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +16,12 @@ import (
 	"github.com/shengjhe/goip/internal/model"
 )
 
+// ipAPIBatchSize ip-api.com 批次端點單次最多 100 個 IP
+const ipAPIBatchSize = 100
+
+// IPAPIBatchPerMinute ip-api.com 批次端點每分鐘的請求上限（與單筆查詢的 45 次分開計算）
+const IPAPIBatchPerMinute = 15
+
 // ExternalAPIType 外部 API 類型
 type ExternalAPIType string
 
@@ -22,75 +31,125 @@ const (
 	ExternalAPIIPAPIco ExternalAPIType = "ipapi.co"
 )
 
+// IsExternalAPI 判斷提供者是否為外部 API
+func IsExternalAPI(providerType string) bool {
+	switch ExternalAPIType(providerType) {
+	case ExternalAPIIPAPI, ExternalAPIIPInfo, ExternalAPIIPAPIco:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProviderKind 取得提供者類別：外部 API 為 api，本地資料庫為 db
+func ProviderKind(providerType string) string {
+	if IsExternalAPI(providerType) {
+		return "api"
+	}
+	return "db"
+}
+
+// ResultSource 判斷結果來源是 db 還是 api（合併結果只要有欄位來自外部 API 即視為 api）
+func ResultSource(info *model.IPInfo) string {
+	if len(info.Sources) > 0 {
+		for _, provider := range info.Sources {
+			if IsExternalAPI(provider) {
+				return "api"
+			}
+		}
+		return "db"
+	}
+	return ProviderKind(info.Provider)
+}
+
 // ExternalAPIRepository 外部 IP API 查詢 repository
 type ExternalAPIRepository struct {
 	apiType    ExternalAPIType
 	httpClient *http.Client
+	quota      *QuotaLimiter // 配額限制（nil 表示不限制）
+	batchQuota *QuotaLimiter // 批次端點的配額限制（nil 表示不限制）
 	mu         sync.RWMutex
 }
 
 // NewExternalAPIRepository 建立新的外部 API repository
-func NewExternalAPIRepository(apiType ExternalAPIType) (*ExternalAPIRepository, error) {
+// batchQuota 為批次端點另外的配額（只有 ip-api 使用）
+func NewExternalAPIRepository(apiType ExternalAPIType, quota, batchQuota *QuotaLimiter) (*ExternalAPIRepository, error) {
 	return &ExternalAPIRepository{
 		apiType: apiType,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		quota:      quota,
+		batchQuota: batchQuota,
 	}, nil
 }
 
 // LookupCountry 查詢 IP 的國家和城市資訊
-func (r *ExternalAPIRepository) LookupCountry(ipStr string) (*model.IPInfo, error) {
+func (r *ExternalAPIRepository) LookupCountry(ctx context.Context, ipStr string) (*model.IPInfo, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	// 呼叫外部 API 前先預扣配額，用盡時直接跳過
+	if r.quota != nil {
+		if err := r.quota.Reserve(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	switch r.apiType {
 	case ExternalAPIIPAPI:
-		return r.queryIPAPI(ipStr)
+		return r.queryIPAPI(ctx, ipStr)
 	case ExternalAPIIPInfo:
-		return r.queryIPInfo(ipStr)
+		return r.queryIPInfo(ctx, ipStr)
 	case ExternalAPIIPAPIco:
-		return r.queryIPAPIco(ipStr)
+		return r.queryIPAPIco(ctx, ipStr)
 	default:
 		return nil, fmt.Errorf("unknown external API type: %s", r.apiType)
 	}
 }
 
+// ipAPIResponse ip-api.com 回應格式（單筆與批次共用）
+type ipAPIResponse struct {
+	Status      string  `json:"status"`
+	Message     string  `json:"message"`
+	Query       string  `json:"query"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"countryCode"`
+	Region      string  `json:"region"`
+	RegionName  string  `json:"regionName"`
+	City        string  `json:"city"`
+	Zip         string  `json:"zip"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Timezone    string  `json:"timezone"`
+	ISP         string  `json:"isp"`
+	Org         string  `json:"org"`
+	AS          string  `json:"as"` // 例如 "AS15169 Google LLC"
+}
+
 // queryIPAPI 查詢 ip-api.com
-func (r *ExternalAPIRepository) queryIPAPI(ipStr string) (*model.IPInfo, error) {
+func (r *ExternalAPIRepository) queryIPAPI(ctx context.Context, ipStr string) (*model.IPInfo, error) {
 	url := fmt.Sprintf("http://ip-api.com/json/%s", ipStr)
-	resp, err := r.httpClient.Get(url)
+	body, err := r.get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("ip-api request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	var apiResp struct {
-		Status      string  `json:"status"`
-		Country     string  `json:"country"`
-		CountryCode string  `json:"countryCode"`
-		Region      string  `json:"region"`
-		RegionName  string  `json:"regionName"`
-		City        string  `json:"city"`
-		Zip         string  `json:"zip"`
-		Lat         float64 `json:"lat"`
-		Lon         float64 `json:"lon"`
-		Timezone    string  `json:"timezone"`
+		return nil, err
 	}
 
+	var apiResp ipAPIResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	// status=fail 代表保留位址或查無資料，屬於正常回應
 	if apiResp.Status != "success" {
-		return nil, fmt.Errorf("ip-api query failed")
+		return nil, fmt.Errorf("ip-api query failed: %s: %w", apiResp.Message, ErrIPNotFound)
 	}
 
+	return r.ipAPIToIPInfo(ipStr, &apiResp), nil
+}
+
+// ipAPIToIPInfo 將 ip-api.com 回應轉換為 IPInfo
+func (r *ExternalAPIRepository) ipAPIToIPInfo(ipStr string, apiResp *ipAPIResponse) *model.IPInfo {
 	ipInfo := &model.IPInfo{
 		IP: ipStr,
 		Country: model.CountryInfo{
@@ -113,21 +172,121 @@ func (r *ExternalAPIRepository) queryIPAPI(ipStr string) (*model.IPInfo, error)
 		}
 	}
 
-	return ipInfo, nil
+	// 網路資訊
+	if apiResp.ISP != "" || apiResp.Org != "" || apiResp.AS != "" {
+		asn, _ := splitASOrg(apiResp.AS)
+		ipInfo.Network = &model.NetworkInfo{
+			ASN:          asn,
+			ISP:          apiResp.ISP,
+			Organization: apiResp.Org,
+		}
+	}
+
+	return ipInfo
 }
 
-// queryIPInfo 查詢 ipinfo.io
-func (r *ExternalAPIRepository) queryIPInfo(ipStr string) (*model.IPInfo, error) {
-	url := fmt.Sprintf("https://ipinfo.io/%s/json", ipStr)
-	resp, err := r.httpClient.Get(url)
+// SupportsBatch 是否支援批次查詢（目前僅 ip-api.com 提供批次端點）
+func (r *ExternalAPIRepository) SupportsBatch() bool {
+	return r.apiType == ExternalAPIIPAPI
+}
+
+// MaxBatchSize 單次批次查詢的最大 IP 數量
+func (r *ExternalAPIRepository) MaxBatchSize() int {
+	return ipAPIBatchSize
+}
+
+// LookupBatch 批次查詢多個 IP，回傳查到的結果（查無資料的 IP 不會出現在結果中）
+// 每次呼叫批次端點預扣一次批次端點的配額，不消耗單筆查詢的配額
+func (r *ExternalAPIRepository) LookupBatch(ctx context.Context, ips []string) (map[string]*model.IPInfo, error) {
+	if !r.SupportsBatch() {
+		return nil, fmt.Errorf("%s does not support batch lookup", r.apiType)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make(map[string]*model.IPInfo, len(ips))
+	for start := 0; start < len(ips); start += ipAPIBatchSize {
+		end := start + ipAPIBatchSize
+		if end > len(ips) {
+			end = len(ips)
+		}
+
+		if r.batchQuota != nil {
+			if err := r.batchQuota.Reserve(ctx); err != nil {
+				return results, err
+			}
+		}
+
+		if err := r.queryIPAPIBatch(ctx, ips[start:end], results); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// queryIPAPIBatch 使用 ip-api.com 的 POST /batch 端點查詢
+func (r *ExternalAPIRepository) queryIPAPIBatch(ctx context.Context, ips []string, results map[string]*model.IPInfo) error {
+	queries := make([]map[string]string, len(ips))
+	for i, ip := range ips {
+		queries[i] = map[string]string{"query": ip}
+	}
+
+	payload, err := json.Marshal(queries)
 	if err != nil {
-		return nil, fmt.Errorf("ipinfo.io request failed: %w", err)
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://ip-api.com/batch", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s batch request failed: %w", r.apiType, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s batch returned HTTP %d", r.apiType, resp.StatusCode)
+	}
+
+	var apiResps []ipAPIResponse
+	if err := json.Unmarshal(body, &apiResps); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// 回應依請求順序排列；query 可能是正規化後的格式（例如壓縮的 IPv6），
+	// 因此以送出的 IP 為鍵，並略過位址與送出的 IP 不同的結果
+	for i := range apiResps {
+		apiResp := &apiResps[i]
+		if i >= len(ips) || apiResp.Status != "success" {
+			continue
+		}
+		sent, queried := net.ParseIP(ips[i]), net.ParseIP(apiResp.Query)
+		if sent == nil || queried == nil || !sent.Equal(queried) {
+			continue
+		}
+		results[ips[i]] = r.ipAPIToIPInfo(ips[i], apiResp)
+	}
+
+	return nil
+}
+
+// queryIPInfo 查詢 ipinfo.io
+func (r *ExternalAPIRepository) queryIPInfo(ctx context.Context, ipStr string) (*model.IPInfo, error) {
+	url := fmt.Sprintf("https://ipinfo.io/%s/json", ipStr)
+	body, err := r.get(ctx, url)
+	if err != nil {
+		return nil, err
 	}
 
 	var apiResp struct {
@@ -138,6 +297,7 @@ func (r *ExternalAPIRepository) queryIPInfo(ipStr string) (*model.IPInfo, error)
 		Loc      string `json:"loc"`
 		Postal   string `json:"postal"`
 		Timezone string `json:"timezone"`
+		Org      string `json:"org"` // 例如 "AS15169 Google LLC"
 	}
 
 	if err := json.Unmarshal(body, &apiResp); err != nil {
@@ -172,21 +332,24 @@ func (r *ExternalAPIRepository) queryIPInfo(ipStr string) (*model.IPInfo, error)
 		}
 	}
 
+	// 網路資訊（免費版的 org 欄位同時包含 ASN 與組織名稱）
+	if apiResp.Org != "" {
+		asn, org := splitASOrg(apiResp.Org)
+		ipInfo.Network = &model.NetworkInfo{
+			ASN:          asn,
+			Organization: org,
+		}
+	}
+
 	return ipInfo, nil
 }
 
 // queryIPAPIco 查詢 ipapi.co
-func (r *ExternalAPIRepository) queryIPAPIco(ipStr string) (*model.IPInfo, error) {
+func (r *ExternalAPIRepository) queryIPAPIco(ctx context.Context, ipStr string) (*model.IPInfo, error) {
 	url := fmt.Sprintf("https://ipapi.co/%s/json/", ipStr)
-	resp, err := r.httpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("ipapi.co request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := r.get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	var apiResp struct {
@@ -202,6 +365,9 @@ func (r *ExternalAPIRepository) queryIPAPIco(ipStr string) (*model.IPInfo, error
 		Latitude      float64 `json:"latitude"`
 		Longitude     float64 `json:"longitude"`
 		Timezone      string  `json:"timezone"`
+		ASN           string  `json:"asn"`
+		Org           string  `json:"org"`
+		Network       string  `json:"network"`
 	}
 
 	if err := json.Unmarshal(body, &apiResp); err != nil {
@@ -237,9 +403,54 @@ func (r *ExternalAPIRepository) queryIPAPIco(ipStr string) (*model.IPInfo, error
 		}
 	}
 
+	// 網路資訊
+	if apiResp.ASN != "" || apiResp.Org != "" || apiResp.Network != "" {
+		ipInfo.Network = &model.NetworkInfo{
+			CIDR:         apiResp.Network,
+			ASN:          apiResp.ASN,
+			Organization: apiResp.Org,
+		}
+	}
+
 	return ipInfo, nil
 }
 
+// splitASOrg 拆解 "AS15169 Google LLC" 格式為 ASN 與組織名稱
+func splitASOrg(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "AS") {
+		return "", value
+	}
+	asn, org, _ := strings.Cut(value, " ")
+	return asn, strings.TrimSpace(org)
+}
+
+// get 發送 GET 請求並讀取回應內容（ctx 取消時中止請求）
+func (r *ExternalAPIRepository) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", r.apiType, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// 非 2xx 回應（例如 429 限流、5xx）視為提供者故障
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned HTTP %d", r.apiType, resp.StatusCode)
+	}
+
+	return body, nil
+}
+
 // Close 關閉連接
 func (r *ExternalAPIRepository) Close() error {
 	// HTTP client 不需要明確關閉
@@ -255,3 +466,19 @@ func (r *ExternalAPIRepository) Reload(dbPath string) error {
 func (r *ExternalAPIRepository) GetProviderType() string {
 	return string(r.apiType)
 }
+
+// QuotaStatus 取得配額使用狀況，批次端點的配額放在 Batch（都未設定時回傳 nil）
+func (r *ExternalAPIRepository) QuotaStatus(ctx context.Context) *model.QuotaStatus {
+	if r.quota == nil && r.batchQuota == nil {
+		return nil
+	}
+
+	status := &model.QuotaStatus{Windows: []model.QuotaWindowStatus{}}
+	if r.quota != nil {
+		status = r.quota.Status(ctx)
+	}
+	if r.batchQuota != nil {
+		status.Batch = r.batchQuota.Status(ctx)
+	}
+	return status
+}
@@ -1,13 +1,16 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/shengjhe/goip/internal/model"
 )
 
 // GeoIPRepository 統一的 GeoIP 查詢介面
 type GeoIPRepository interface {
 	// LookupCountry 查詢 IP 的國家和城市資訊
-	LookupCountry(ip string) (*model.IPInfo, error)
+	// ctx 取消或逾時時，提供者應盡快中止查詢（例如外部 API 的 HTTP 請求）
+	LookupCountry(ctx context.Context, ip string) (*model.IPInfo, error)
 
 	// Close 關閉資料庫連接
 	Close() error
@@ -18,3 +21,27 @@ type GeoIPRepository interface {
 	// GetProviderType 取得提供者類型
 	GetProviderType() string
 }
+
+// MetadataProvider 可提供資料庫中繼資料的提供者（本地資料庫）
+type MetadataProvider interface {
+	// Metadata 取得資料庫中繼資料（建置時間、語言、檔案大小與 SHA-256 等）
+	Metadata() (*model.ProviderMetadata, error)
+}
+
+// FileProvider 由本地資料庫檔案載入的提供者
+type FileProvider interface {
+	// DBPath 目前載入的資料庫檔案路徑
+	DBPath() string
+}
+
+// BatchProvider 支援批次查詢的提供者
+type BatchProvider interface {
+	// SupportsBatch 是否支援批次查詢
+	SupportsBatch() bool
+
+	// MaxBatchSize 單次批次查詢的最大 IP 數量
+	MaxBatchSize() int
+
+	// LookupBatch 批次查詢多個 IP，回傳查到的結果
+	LookupBatch(ctx context.Context, ips []string) (map[string]*model.IPInfo, error)
+}
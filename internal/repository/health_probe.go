@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+// probeTimeout 單次探測的逾時
+const probeTimeout = 5 * time.Second
+
+var (
+	ErrCanaryMismatch = errors.New("canary country mismatch")
+)
+
+// Canary 健康檢查用 IP 與預期國碼（Country 為空時只檢查能否查詢）
+type Canary struct {
+	IP      string
+	Country string
+}
+
+// DefaultCanaries 預設健康檢查用 IP
+var DefaultCanaries = []Canary{
+	{IP: "8.8.8.8", Country: "US"},
+	{IP: "1.1.1.1"},
+}
+
+// ProbeOptions 不健康提供者的背景探測選項
+type ProbeOptions struct {
+	Interval time.Duration // 探測間隔（0 表示不探測，只依後續查詢結果恢復）
+	Canaries []Canary      // 探測用 IP，全部通過才視為恢復
+}
+
+// StartHealthProbes 啟動背景探測：定期以 canary IP 查詢不健康的提供者，成功後恢復其路由順序
+// 外部 API 的探測也會消耗配額
+func (r *MultiProviderRepository) StartHealthProbes() {
+	if r.probe.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.probe.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.probeUnhealthy()
+			case <-r.probeStop:
+				return
+			}
+		}
+	}()
+}
+
+// StopHealthProbes 停止背景探測
+func (r *MultiProviderRepository) StopHealthProbes() {
+	r.probeOnce.Do(func() {
+		close(r.probeStop)
+	})
+}
+
+// probeUnhealthy 探測所有不健康的提供者
+func (r *MultiProviderRepository) probeUnhealthy() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	canaries := r.probe.Canaries
+	if len(canaries) == 0 {
+		canaries = DefaultCanaries
+	}
+
+	for i := range r.providers {
+		p := &r.providers[i]
+		if p.Health == nil || p.Health.Healthy() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		start := time.Now()
+		probeErr := CheckCanaries(ctx, p.Provider, canaries)
+		latency := time.Since(start) / time.Duration(len(canaries))
+		cancel()
+
+		// 配額用盡時無法判斷是否恢復，留待下次探測
+		if errors.Is(probeErr, ErrQuotaExceeded) {
+			continue
+		}
+		p.Health.RecordProbe(latency, probeErr)
+	}
+}
+
+// CheckCanaries 以 canary IP 直接查詢提供者（不經過斷路器）
+// 提供者故障、配額用盡或國碼與預期不符時回傳錯誤；提供者沒有 ISO 國碼時（例如 IPIP 免費版）不比對國碼
+func CheckCanaries(ctx context.Context, provider GeoIPRepository, canaries []Canary) error {
+	for _, canary := range canaries {
+		info, err := provider.LookupCountry(ctx, canary.IP)
+		if err != nil {
+			if isProviderFailure(err) || errors.Is(err, ErrQuotaExceeded) {
+				return fmt.Errorf("canary %s: %w", canary.IP, err)
+			}
+			// 查無資料：有預期國碼時視為資料異常
+			if canary.Country != "" {
+				return fmt.Errorf("canary %s: expected %s, got not found: %w", canary.IP, canary.Country, ErrCanaryMismatch)
+			}
+			continue
+		}
+
+		if canary.Country != "" && info.Country.ISOCode != "" && !strings.EqualFold(info.Country.ISOCode, canary.Country) {
+			return fmt.Errorf("canary %s: expected %s, got %s: %w", canary.IP, canary.Country, info.Country.ISOCode, ErrCanaryMismatch)
+		}
+	}
+	return nil
+}
+
+// CheckProviders 逐一檢查每個提供者
+// 本地資料庫以 canary IP 實際查詢，失敗時為 unhealthy；
+// 外部 API 為選用，不實際呼叫（避免消耗配額），依斷路器、健康追蹤與配額狀態判斷，異常時為 degraded
+func (r *MultiProviderRepository) CheckProviders(ctx context.Context, canaries []Canary) []model.ProviderCheck {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checks := make([]model.ProviderCheck, len(r.providers))
+	var wg sync.WaitGroup
+
+	for i := range r.providers {
+		p := &r.providers[i]
+		if IsExternalAPI(p.Provider.GetProviderType()) {
+			checks[i] = r.checkExternal(ctx, p)
+			continue
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			checks[idx] = CheckProvider(ctx, p.Provider, canaries)
+		}(i)
+	}
+
+	wg.Wait()
+	return checks
+}
+
+// CheckProvider 以 canary IP 檢查單一本地資料庫提供者
+func CheckProvider(ctx context.Context, provider GeoIPRepository, canaries []Canary) model.ProviderCheck {
+	providerType := provider.GetProviderType()
+	check := model.ProviderCheck{
+		Name:     providerType,
+		Kind:     ProviderKind(providerType),
+		Required: true,
+		Status:   model.HealthStatusHealthy,
+	}
+
+	start := time.Now()
+	err := CheckCanaries(ctx, provider, canaries)
+	check.LatencyMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		check.Status = model.HealthStatusUnhealthy
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// checkExternal 依被動狀態檢查外部 API 提供者
+func (r *MultiProviderRepository) checkExternal(ctx context.Context, p *ProviderInfo) model.ProviderCheck {
+	providerType := p.Provider.GetProviderType()
+	check := model.ProviderCheck{
+		Name:   providerType,
+		Kind:   ProviderKind(providerType),
+		Status: model.HealthStatusHealthy,
+	}
+
+	var problems []string
+	if p.Breaker != nil && p.Breaker.State() == CircuitOpen {
+		problems = append(problems, "circuit open")
+	}
+	if p.Health != nil && !p.Health.Healthy() {
+		problems = append(problems, "unhealthy")
+	}
+	if reporter, ok := p.Provider.(QuotaReporter); ok {
+		if quota := reporter.QuotaStatus(ctx); quota != nil {
+			if quota.Exhausted {
+				problems = append(problems, "quota exhausted")
+			}
+			if quota.Batch != nil && quota.Batch.Exhausted {
+				problems = append(problems, "batch quota exhausted")
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		check.Status = model.HealthStatusDegraded
+		check.Error = strings.Join(problems, ", ")
+	}
+	return check
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	// hotIPsKey 記錄 IP 查詢次數的 Sorted Set（不在 goip:country: 之下，清除快取時保留）
+	hotIPsKey = "goip:hot_ips"
+
+	// maxHotIPs 最多保留的 IP 數量，超過時移除查詢次數最少的 IP
+	maxHotIPs = 10000
+
+	// hotIPsTTL 停止查詢後保留的時間
+	hotIPsTTL = 7 * 24 * time.Hour
+)
+
+// IncrHotIPs 累加 IP 的查詢次數並只保留次數最多的 maxHotIPs 個
+func (r *cacheRepository) IncrHotIPs(ctx context.Context, counts map[string]float64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	for ip, count := range counts {
+		pipe.ZIncrBy(ctx, hotIPsKey, count, ip)
+	}
+	pipe.ZRemRangeByRank(ctx, hotIPsKey, 0, -maxHotIPs-1)
+	pipe.Expire(ctx, hotIPsKey, hotIPsTTL)
+
+	start := time.Now()
+	_, err := pipe.Exec(ctx)
+	return r.track(start, err)
+}
+
+// HotIPs 查詢次數最多的 IP（由多到少）
+func (r *cacheRepository) HotIPs(ctx context.Context, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	return r.client.ZRevRange(ctx, hotIPsKey, 0, int64(limit-1)).Result()
+}
+
+// IncrHotIPs 累加 IP 的查詢次數，超過 2 倍 maxHotIPs 時只保留次數最多的 maxHotIPs 個
+func (r *memoryCacheRepository) IncrHotIPs(ctx context.Context, counts map[string]float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ip, count := range counts {
+		r.hot[ip] += count
+	}
+
+	if len(r.hot) > 2*maxHotIPs {
+		kept := make(map[string]float64, maxHotIPs)
+		for _, ip := range topHotIPs(r.hot, maxHotIPs) {
+			kept[ip] = r.hot[ip]
+		}
+		r.hot = kept
+	}
+	return nil
+}
+
+// HotIPs 查詢次數最多的 IP（由多到少）
+func (r *memoryCacheRepository) HotIPs(ctx context.Context, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return topHotIPs(r.hot, limit), nil
+}
+
+// topHotIPs 依查詢次數由多到少取前 limit 個 IP
+func topHotIPs(counts map[string]float64, limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+
+	ips := make([]string, 0, len(counts))
+	for ip := range counts {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if counts[ips[i]] != counts[ips[j]] {
+			return counts[ips[i]] > counts[ips[j]]
+		}
+		return ips[i] < ips[j]
+	})
+
+	if len(ips) > limit {
+		ips = ips[:limit]
+	}
+	return ips
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sync"
@@ -22,6 +23,7 @@ type ipipRepository struct {
 	reader       *ipdb.City
 	dbPath       string
 	providerType string
+	digest       fileDigest
 	mu           sync.RWMutex
 }
 
@@ -40,7 +42,11 @@ func NewIPIPRepository(dbPath string) (IPIPRepository, error) {
 }
 
 // LookupCountry 查詢 IP 的國家和城市資訊
-func (r *ipipRepository) LookupCountry(ipStr string) (*model.IPInfo, error) {
+func (r *ipipRepository) LookupCountry(ctx context.Context, ipStr string) (*model.IPInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -111,6 +117,16 @@ func (r *ipipRepository) LookupCountry(ipStr string) (*model.IPInfo, error) {
 		}
 	}
 
+	// 網路資訊（付費版才有運營商欄位）
+	ispDomain := info["isp_domain"]
+	ownerDomain := info["owner_domain"]
+	if ispDomain != "" || ownerDomain != "" {
+		ipInfo.Network = &model.NetworkInfo{
+			ISP:          ispDomain,
+			Organization: ownerDomain,
+		}
+	}
+
 	return ipInfo, nil
 }
 
@@ -142,6 +158,40 @@ func (r *ipipRepository) Reload(dbPath string) error {
 	return nil
 }
 
+// Metadata 取得資料庫中繼資料
+func (r *ipipRepository) Metadata() (*model.ProviderMetadata, error) {
+	r.mu.RLock()
+	if r.reader == nil {
+		r.mu.RUnlock()
+		return nil, ErrDatabaseClosed
+	}
+	metadata := &model.ProviderMetadata{
+		DatabaseType: "ipdb",
+		Languages:    r.reader.Languages(),
+		Fields:       r.reader.Fields(),
+	}
+	if r.reader.IsIPv4() {
+		metadata.IPVersions = append(metadata.IPVersions, 4)
+	}
+	if r.reader.IsIPv6() {
+		metadata.IPVersions = append(metadata.IPVersions, 6)
+	}
+	setBuildTime(metadata, r.reader.BuildTime())
+	dbPath := r.dbPath
+	r.mu.RUnlock()
+
+	// 計算 SHA-256 時不持有鎖，避免阻塞查詢
+	r.digest.describe(dbPath, metadata)
+	return metadata, nil
+}
+
+// DBPath 目前載入的資料庫檔案路徑
+func (r *ipipRepository) DBPath() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dbPath
+}
+
 // GetProviderType 取得提供者類型
 func (r *ipipRepository) GetProviderType() string {
 	return r.providerType
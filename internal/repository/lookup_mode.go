@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+const (
+	// LookupModeRoute 依路由表取單一提供者的完整結果（預設）
+	LookupModeRoute = "route"
+	// LookupModeMerge 依欄位優先順序從多個提供者組合結果
+	LookupModeMerge = "merge"
+	// LookupModeConsensus 多個提供者投票決定國家
+	LookupModeConsensus = "consensus"
+)
+
+var (
+	ErrUnknownMode = errors.New("unknown lookup mode")
+	ErrReservedIP  = fmt.Errorf("reserved IP address: %w", ErrIPNotFound)
+)
+
+// IsValidLookupMode 檢查查詢模式是否支援（空字串表示預設模式）
+func IsValidLookupMode(mode string) bool {
+	switch mode {
+	case "", LookupModeRoute, LookupModeMerge, LookupModeConsensus:
+		return true
+	default:
+		return false
+	}
+}
+
+// LookupWithMode 依指定模式查詢 IP
+func (r *MultiProviderRepository) LookupWithMode(ctx context.Context, ipStr, mode string) (*model.IPInfo, error) {
+	switch mode {
+	case "", LookupModeRoute:
+		return r.LookupCountry(ctx, ipStr)
+	case LookupModeMerge:
+		return r.LookupMerged(ctx, ipStr)
+	case LookupModeConsensus:
+		return r.LookupConsensus(ctx, ipStr)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMode, mode)
+	}
+}
@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/shengjhe/goip/internal/model"
 	"github.com/oschwald/geoip2-golang"
@@ -24,6 +26,7 @@ type maxMindRepository struct {
 	reader       *geoip2.Reader
 	dbPath       string
 	providerType string
+	digest       fileDigest
 	mu           sync.RWMutex
 }
 
@@ -42,7 +45,11 @@ func NewMaxMindRepository(dbPath string) (MaxMindRepository, error) {
 }
 
 // LookupCountry 查詢 IP 的國家和城市資訊
-func (r *maxMindRepository) LookupCountry(ipStr string) (*model.IPInfo, error) {
+func (r *maxMindRepository) LookupCountry(ctx context.Context, ipStr string) (*model.IPInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -62,6 +69,12 @@ func (r *maxMindRepository) LookupCountry(ipStr string) (*model.IPInfo, error) {
 		return nil, ErrIPNotFound
 	}
 
+	// 資料庫沒有此 IP 的記錄時會回傳空白結果（例如保留位址），視為查無資料
+	if record.Country.IsoCode == "" && record.RegisteredCountry.IsoCode == "" &&
+		record.Continent.Code == "" && record.City.GeoNameID == 0 {
+		return nil, ErrIPNotFound
+	}
+
 	// 組裝回應 - 確保所有必填欄位都有值
 	info := &model.IPInfo{
 		IP: ipStr,
@@ -134,6 +147,41 @@ func (r *maxMindRepository) Reload(dbPath string) error {
 	return nil
 }
 
+// Metadata 取得資料庫中繼資料
+func (r *maxMindRepository) Metadata() (*model.ProviderMetadata, error) {
+	r.mu.RLock()
+	if r.reader == nil {
+		r.mu.RUnlock()
+		return nil, ErrDatabaseClosed
+	}
+	meta := r.reader.Metadata()
+	dbPath := r.dbPath
+	r.mu.RUnlock()
+
+	metadata := &model.ProviderMetadata{
+		DatabaseType: meta.DatabaseType,
+		Languages:    meta.Languages,
+		NodeCount:    meta.NodeCount,
+		IPVersions:   []int{4},
+	}
+	// IPv6 資料庫同時包含 IPv4 位址
+	if meta.IPVersion == 6 {
+		metadata.IPVersions = []int{4, 6}
+	}
+	setBuildTime(metadata, time.Unix(int64(meta.BuildEpoch), 0))
+
+	// 計算 SHA-256 時不持有鎖，避免阻塞查詢
+	r.digest.describe(dbPath, metadata)
+	return metadata, nil
+}
+
+// DBPath 目前載入的資料庫檔案路徑
+func (r *maxMindRepository) DBPath() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dbPath
+}
+
 // GetProviderType 取得提供者類型
 func (r *maxMindRepository) GetProviderType() string {
 	return r.providerType
@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+// defaultMemoryCacheEntries 未設定最大項目數時的預設值
+const defaultMemoryCacheEntries = 100000
+
+// memoryCacheItem 記憶體快取項目
+type memoryCacheItem struct {
+	key       string
+	data      []byte    // 與 Redis 相同的編碼格式；nil 表示查無資料
+	expiresAt time.Time // 零值表示不過期
+}
+
+// memoryCacheRepository 行程內的 LRU 快取，不需要 Redis（單一實例或邊緣部署使用）
+type memoryCacheRepository struct {
+	stale      StalePolicy
+	compress   bool
+	maxEntries int
+
+	mu      sync.Mutex
+	version string
+	items   map[string]*list.Element
+	lru     *list.List // 最近使用的項目在前
+	bytes   uint64     // 鍵與值的總大小（近似記憶體用量）
+	evicted uint64
+	expired uint64
+	hot     map[string]float64 // IP 查詢次數（供快取預熱使用）
+
+	counters cacheCounters
+}
+
+// NewMemoryCacheRepository 建立記憶體快取，超過 opts.MaxEntries 時淘汰最久未使用的項目
+func NewMemoryCacheRepository(opts CacheOptions) CacheRepository {
+	maxEntries := opts.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMemoryCacheEntries
+	}
+
+	return &memoryCacheRepository{
+		stale:      opts.Stale,
+		compress:   opts.Compress,
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		hot:        make(map[string]float64),
+	}
+}
+
+// load 取得未過期的項目並標記為最近使用，同時回傳剩餘 TTL（不過期時為 -1）
+func (r *memoryCacheRepository) load(key string, now time.Time) (*memoryCacheItem, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.items[key]
+	if !ok {
+		return nil, 0, false
+	}
+
+	item := elem.Value.(*memoryCacheItem)
+	if item.expiresAt.IsZero() {
+		r.lru.MoveToFront(elem)
+		return item, -1, true
+	}
+
+	remaining := item.expiresAt.Sub(now)
+	if remaining <= 0 {
+		r.remove(elem)
+		r.expired++
+		return nil, 0, false
+	}
+
+	r.lru.MoveToFront(elem)
+	return item, remaining, true
+}
+
+// store 寫入項目，超過容量時淘汰最久未使用的項目
+func (r *memoryCacheRepository) store(key string, data []byte, ttl time.Duration, now time.Time) {
+	item := &memoryCacheItem{key: key, data: data}
+	if ttl > 0 {
+		item.expiresAt = now.Add(ttl)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.items[key]; ok {
+		r.remove(elem)
+	}
+	r.items[key] = r.lru.PushFront(item)
+	r.bytes += uint64(len(key) + len(data))
+
+	for r.lru.Len() > r.maxEntries {
+		r.remove(r.lru.Back())
+		r.evicted++
+	}
+}
+
+// remove 移除項目（呼叫端需持有鎖）
+func (r *memoryCacheRepository) remove(elem *list.Element) {
+	item := r.lru.Remove(elem).(*memoryCacheItem)
+	delete(r.items, item.key)
+	r.bytes -= uint64(len(item.key) + len(item.data))
+}
+
+// key 產生目前資料集版本的快取鍵
+func (r *memoryCacheRepository) key(ip string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return versionedKey(r.version, ip)
+}
+
+// entry 將項目轉為快取結果
+func (r *memoryCacheRepository) entry(item *memoryCacheItem, remaining time.Duration) (*CacheEntry, error) {
+	info, err := decodeEntry(item.data)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheEntry{
+		Info:      info,
+		Freshness: r.stale.freshness(ResultSource(info), remaining),
+	}, nil
+}
+
+// Get 獲取單一快取（含新鮮度），未命中時回傳 ErrCacheMiss，快取為查無資料時回傳 ErrNegativeCache
+func (r *memoryCacheRepository) Get(ctx context.Context, ip string) (*CacheEntry, error) {
+	item, remaining, ok := r.load(r.key(ip), time.Now())
+	if !ok {
+		r.counters.record(0, 1)
+		return nil, ErrCacheMiss
+	}
+	if item.data == nil {
+		r.counters.record(1, 0)
+		return nil, ErrNegativeCache
+	}
+
+	entry, err := r.entry(item, remaining)
+	if err != nil {
+		r.counters.record(0, 1)
+		return nil, err
+	}
+	r.counters.record(1, 0)
+	return entry, nil
+}
+
+// Set 設定快取
+func (r *memoryCacheRepository) Set(ctx context.Context, ip string, info *model.IPInfo, ttl time.Duration) error {
+	now := time.Now()
+	data, err := encodeEntry(info, r.DatasetVersion(), r.compress, now)
+	if err != nil {
+		return err
+	}
+
+	r.store(r.key(ip), data, r.stale.hardTTL(ResultSource(info), ttl), now)
+	return nil
+}
+
+// SetNotFound 快取查無資料的結果
+func (r *memoryCacheRepository) SetNotFound(ctx context.Context, ip string, ttl time.Duration) error {
+	r.store(r.key(ip), nil, ttl, time.Now())
+	return nil
+}
+
+// MGet 批次獲取多個快取（含新鮮度），快取為查無資料的 IP 對應 Info 為 nil
+func (r *memoryCacheRepository) MGet(ctx context.Context, ips []string) (map[string]*CacheEntry, error) {
+	results := make(map[string]*CacheEntry)
+	now := time.Now()
+
+	for _, ip := range ips {
+		item, remaining, ok := r.load(r.key(ip), now)
+		if !ok {
+			continue
+		}
+		if item.data == nil {
+			results[ip] = &CacheEntry{}
+			continue
+		}
+		if entry, err := r.entry(item, remaining); err == nil {
+			results[ip] = entry
+		}
+	}
+
+	r.counters.record(len(results), len(ips)-len(results))
+	return results, nil
+}
+
+// MSet 批次設定多個快取
+func (r *memoryCacheRepository) MSet(ctx context.Context, items map[string]*model.IPInfo, ttl time.Duration) error {
+	// 編碼失敗的項目略過（與 Redis 版本一致）
+	for ip, info := range items {
+		r.Set(ctx, ip, info, ttl)
+	}
+	return nil
+}
+
+// Delete 刪除快取
+func (r *memoryCacheRepository) Delete(ctx context.Context, ips ...string) error {
+	keys := make([]string, len(ips))
+	for i, ip := range ips {
+		keys[i] = r.key(ip)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := r.items[key]; ok {
+			r.remove(elem)
+		}
+	}
+	return nil
+}
+
+// UseDatasetVersion 切換到資料集版本的命名空間（不跨重啟保留，重啟後快取本來就是空的）
+func (r *memoryCacheRepository) UseDatasetVersion(ctx context.Context, version string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.version
+	r.version = version
+	return previous, nil
+}
+
+// DatasetVersion 目前使用的資料集版本
+func (r *memoryCacheRepository) DatasetVersion() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.version
+}
+
+// DeleteDatasetVersion 刪除指定資料集版本的所有快取
+func (r *memoryCacheRepository) DeleteDatasetVersion(ctx context.Context, version string) (int64, error) {
+	if version == "" {
+		return 0, nil
+	}
+	return r.deletePrefix(keyPrefix + version + ":"), nil
+}
+
+// Exists 檢查快取是否存在
+func (r *memoryCacheRepository) Exists(ctx context.Context, ip string) (bool, error) {
+	_, _, ok := r.load(r.key(ip), time.Now())
+	return ok, nil
+}
+
+// FlushAll 清空所有快取（包含所有資料集版本）
+func (r *memoryCacheRepository) FlushAll(ctx context.Context) error {
+	r.deletePrefix(keyPrefix)
+	return nil
+}
+
+// deletePrefix 刪除符合前綴的項目，回傳刪除數量
+func (r *memoryCacheRepository) deletePrefix(prefix string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key, elem := range r.items {
+		if strings.HasPrefix(key, prefix) {
+			r.remove(elem)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// GetStats 獲取快取統計
+func (r *memoryCacheRepository) GetStats(ctx context.Context) (*model.CacheStats, error) {
+	hits := atomic.LoadUint64(&r.counters.hits)
+	misses := atomic.LoadUint64(&r.counters.misses)
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &model.CacheStats{
+		Backend:     "memory",
+		CacheHits:   hits,
+		CacheMisses: misses,
+		HitRate:     hitRate,
+		UsedMemory:  r.bytes,
+		DBKeys:      uint64(len(r.items)),
+		KeyCount:    uint64(len(r.items)),
+		EvictedKeys: r.evicted,
+		ExpiredKeys: r.expired,
+
+		DatasetVersion: r.version,
+	}, nil
+}
+
+// Close 釋放所有項目
+func (r *memoryCacheRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.items = make(map[string]*list.Element)
+	r.lru.Init()
+	r.bytes = 0
+	return nil
+}
+
+// HealthCheck 記憶體快取永遠可用
+func (r *memoryCacheRepository) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Backend 快取後端名稱
+func (r *memoryCacheRepository) Backend() string {
+	return "memory"
+}
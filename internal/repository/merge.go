@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"net"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+// MergedProvider 合併結果的 provider 名稱，實際來源記錄在 sources
+const MergedProvider = "merged"
+
+// 可合併的欄位
+const (
+	FieldCountry   = "country"
+	FieldCity      = "city"
+	FieldLocation  = "location"
+	FieldContinent = "continent"
+	FieldNetwork   = "network"
+)
+
+// mergeFields 合併時依序處理的欄位
+var mergeFields = []string{FieldCountry, FieldCity, FieldLocation, FieldContinent, FieldNetwork}
+
+// MergePolicy 欄位合併策略：欄位 -> 提供者優先順序
+// 未設定的欄位沿用路由規則的提供者鏈順序
+type MergePolicy map[string][]string
+
+// IsMergeField 檢查欄位名稱是否可合併
+func IsMergeField(field string) bool {
+	return containsString(mergeFields, field)
+}
+
+// LookupMerged 合併模式查詢：每個欄位依合併策略採用第一個有資料的提供者，
+// 提供者只在需要時查詢且每個最多查詢一次，sources 記錄各欄位的實際來源
+func (r *MultiProviderRepository) LookupMerged(ctx context.Context, ipStr string) (*model.IPInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, ErrInvalidIP
+	}
+
+	a := r.newAttempter(ctx, ipStr)
+	chain := r.providerChain(r.matchRule(ip, a.attempt))
+
+	merged := &model.IPInfo{
+		IP:       ipStr,
+		Provider: MergedProvider,
+		Sources:  make(map[string]string),
+	}
+
+	for _, field := range mergeFields {
+		for _, p := range r.mergeOrder(field, chain) {
+			info := a.attempt(p)
+			if info != nil && mergeField(merged, info, field) {
+				merged.Sources[field] = p.Provider.GetProviderType()
+				break
+			}
+		}
+	}
+
+	if len(merged.Sources) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if a.notFound() {
+			return nil, ErrIPNotFound
+		}
+		return nil, ErrAllFailed
+	}
+
+	return merged, nil
+}
+
+// mergeOrder 取得欄位的提供者順序：有設定策略時依策略，否則沿用提供者鏈
+func (r *MultiProviderRepository) mergeOrder(field string, chain []*ProviderInfo) []*ProviderInfo {
+	names := r.mergePolicy[field]
+	if len(names) == 0 {
+		return chain
+	}
+
+	order := make([]*ProviderInfo, 0, len(names))
+	for _, providerType := range names {
+		if p := r.getProviderInfo(providerType); p != nil {
+			order = append(order, p)
+		}
+	}
+	return demoteUnhealthy(order)
+}
+
+// mergeField 若 info 有該欄位的資料則寫入 merged，回傳是否採用
+func mergeField(merged, info *model.IPInfo, field string) bool {
+	switch field {
+	case FieldCountry:
+		if info.Country.ISOCode == "" && info.Country.Name == "" {
+			return false
+		}
+		merged.Country = info.Country
+	case FieldCity:
+		if info.City.Name == "" && info.City.NameZh == "" {
+			return false
+		}
+		merged.City = info.City
+	case FieldLocation:
+		if info.Location == nil || (info.Location.Latitude == 0 && info.Location.Longitude == 0) {
+			return false
+		}
+		merged.Location = info.Location
+	case FieldContinent:
+		if info.Continent == nil || info.Continent.Code == "" {
+			return false
+		}
+		merged.Continent = info.Continent
+	case FieldNetwork:
+		if info.Network == nil {
+			return false
+		}
+		merged.Network = info.Network
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+// fileDigest 資料庫檔案的大小與 SHA-256
+// 依路徑、大小與修改時間快取，檔案沒有變動時不重新計算
+type fileDigest struct {
+	mu      sync.Mutex
+	path    string
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// describe 將檔案路徑、大小與 SHA-256 寫入 metadata，失敗時記錄於 Error
+func (d *fileDigest) describe(path string, metadata *model.ProviderMetadata) {
+	metadata.FilePath = path
+
+	size, sum, err := d.compute(path)
+	if err != nil {
+		metadata.Error = err.Error()
+		return
+	}
+	metadata.FileSize = size
+	metadata.SHA256 = sum
+}
+
+// compute 取得檔案大小與 SHA-256
+func (d *fileDigest) compute(path string) (int64, string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.path == path && d.size == stat.Size() && d.modTime.Equal(stat.ModTime()) {
+		return d.size, d.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return 0, "", err
+	}
+
+	d.path = path
+	d.size = stat.Size()
+	d.modTime = stat.ModTime()
+	d.sum = hex.EncodeToString(hash.Sum(nil))
+	return d.size, d.sum, nil
+}
+
+// DescribeProvider 取得提供者的資料庫中繼資料（外部 API 回傳 nil）
+func DescribeProvider(provider GeoIPRepository) *model.ProviderMetadata {
+	mp, ok := provider.(MetadataProvider)
+	if !ok {
+		return nil
+	}
+
+	metadata, err := mp.Metadata()
+	if err != nil {
+		return &model.ProviderMetadata{Error: err.Error()}
+	}
+	return metadata
+}
+
+// setBuildTime 設定建置時間與距今天數
+func setBuildTime(metadata *model.ProviderMetadata, buildTime time.Time) {
+	if buildTime.IsZero() {
+		return
+	}
+	buildTime = buildTime.UTC()
+	metadata.BuildTime = &buildTime
+	metadata.AgeDays = int(time.Since(buildTime).Hours() / 24)
+}
+
+// MarkStale 依建置時間標記資料庫是否過期（staleAfter <= 0 表示不檢查）
+func MarkStale(metadata *model.ProviderMetadata, staleAfter time.Duration) {
+	if metadata == nil || metadata.BuildTime == nil || staleAfter <= 0 {
+		return
+	}
+	metadata.Stale = time.Since(*metadata.BuildTime) > staleAfter
+}
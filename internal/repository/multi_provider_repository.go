@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/shengjhe/goip/internal/model"
 )
@@ -18,125 +22,520 @@ var (
 type ProviderInfo struct {
 	Provider GeoIPRepository
 	Priority int
-	Region   string // cn, global, all
+	Region   string          // cn, global, all
+	Breaker  *CircuitBreaker // 斷路器（nil 表示不啟用）
+	Health   *ProviderHealth // 健康追蹤（nil 表示不啟用）
+}
+
+// QuotaReporter 可回報配額使用狀況的提供者
+type QuotaReporter interface {
+	QuotaStatus(ctx context.Context) *model.QuotaStatus
+}
+
+// MultiProviderOptions 多提供者 Repository 選項
+type MultiProviderOptions struct {
+	Routing   RoutingTable     // 路由表（未設定規則時依 region 產生預設路由）
+	Merge     MergePolicy      // 合併模式的欄位優先順序
+	Consensus ConsensusOptions // 投票模式選項
+	Probe     ProbeOptions     // 不健康提供者的背景探測
 }
 
 // MultiProviderRepository 多提供者 Repository，支持智能路由
 type MultiProviderRepository struct {
-	providers []ProviderInfo
-	mu        sync.RWMutex
+	providers      []ProviderInfo
+	rules          []RoutingRule
+	detectProvider string
+	mergePolicy    MergePolicy
+	consensus      ConsensusOptions
+	probe          ProbeOptions
+	probeStop      chan struct{}
+	probeOnce      sync.Once
+	mu             sync.RWMutex
 }
 
 // NewMultiProviderRepository 建立新的多提供者 repository
-func NewMultiProviderRepository(providers []ProviderInfo) (*MultiProviderRepository, error) {
+func NewMultiProviderRepository(providers []ProviderInfo, opts MultiProviderOptions) (*MultiProviderRepository, error) {
 	if len(providers) == 0 {
 		return nil, ErrNoProviders
 	}
 
-	// 按優先級排序
-	sort.Slice(providers, func(i, j int) bool {
+	// 按優先級排序（穩定排序，同優先級維持配置順序）
+	sort.SliceStable(providers, func(i, j int) bool {
 		return providers[i].Priority < providers[j].Priority
 	})
 
-	return &MultiProviderRepository{
-		providers: providers,
-	}, nil
+	repo := &MultiProviderRepository{
+		providers:      providers,
+		rules:          opts.Routing.Rules,
+		detectProvider: opts.Routing.DetectProvider,
+		mergePolicy:    opts.Merge,
+		consensus:      opts.Consensus,
+		probe:          opts.Probe,
+		probeStop:      make(chan struct{}),
+	}
+
+	if repo.detectProvider == "" {
+		repo.detectProvider = defaultDetectProvider
+	}
+	if len(repo.rules) == 0 {
+		repo.rules = legacyRoutingRules(providers)
+	}
+
+	// 檢查規則中的提供者都已配置
+	for _, rule := range repo.rules {
+		for _, providerType := range rule.Providers {
+			if repo.getProviderInfo(providerType) == nil {
+				return nil, fmt.Errorf("routing rule %q references unknown provider: %s", rule.Name, providerType)
+			}
+		}
+	}
+
+	for field, providerTypes := range repo.mergePolicy {
+		if !IsMergeField(field) {
+			return nil, fmt.Errorf("merge policy references unknown field: %s", field)
+		}
+		for _, providerType := range providerTypes {
+			if repo.getProviderInfo(providerType) == nil {
+				return nil, fmt.Errorf("merge policy for %s references unknown provider: %s", field, providerType)
+			}
+		}
+	}
+
+	return repo, nil
 }
 
 // LookupCountry 智能查詢 IP 的國家和城市資訊
 // 策略：
-// 1. 先用 MaxMind 判斷國家
-// 2. 根據國家選擇最佳資料庫
-// 3. 如果 city 為空，自動嘗試其他 provider
-func (r *MultiProviderRepository) LookupCountry(ipStr string) (*model.IPInfo, error) {
+// 1. 依路由表找出第一個符合的規則（國家、大洲規則會先用 detect provider 判斷）
+// 2. 依規則的提供者鏈查詢，直到結果滿足停止條件（預設需有城市資訊）
+// 3. 規則鏈無法滿足時，依 fallback 策略嘗試其餘提供者
+func (r *MultiProviderRepository) LookupCountry(ctx context.Context, ipStr string) (*model.IPInfo, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	// 先用 MaxMind 快速判斷國家（MaxMind 速度快且準確）
-	var countryCode string
-	var maxmindInfo *model.IPInfo
-	maxmindProvider := r.getProviderByType("maxmind")
-	if maxmindProvider != nil {
-		info, err := maxmindProvider.LookupCountry(ipStr)
-		if err == nil && info != nil {
-			maxmindInfo = info
-			if info.Country.ISOCode != "" {
-				countryCode = info.Country.ISOCode
+	outcome, err := r.route(ctx, ipStr, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 沒有提供者滿足停止條件時，返回第一個成功的結果（至少有國家資訊）
+	if outcome.best != nil {
+		return outcome.best, nil
+	}
+
+	// 查詢被取消或逾時
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 所有查詢的提供者都明確回報查無資料（例如保留位址），與提供者故障區分
+	if outcome.notFound {
+		return nil, ErrIPNotFound
+	}
+
+	// 所有提供者都失敗
+	return nil, ErrAllFailed
+}
+
+// routeOutcome 單一 IP 的路由查詢結果
+type routeOutcome struct {
+	rule     *RoutingRule
+	best     *model.IPInfo   // 滿足停止條件的結果，或第一個成功的結果
+	done     bool            // 是否已滿足停止條件
+	deferred []*ProviderInfo // 延後查詢的外部 API（批次模式）
+	notFound bool            // 沒有結果且所有查詢的提供者都回報查無資料
+}
+
+// route 依路由表查詢單一 IP
+// deferExternal 為 true 時不呼叫外部 API，改記錄於 deferred 由呼叫端合併成批次請求
+func (r *MultiProviderRepository) route(ctx context.Context, ipStr string, deferExternal bool) (*routeOutcome, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, ErrInvalidIP
+	}
+
+	a := r.newAttempter(ctx, ipStr)
+	outcome := &routeOutcome{rule: r.matchRule(ip, a.attempt)}
+
+	for _, p := range r.providerChain(outcome.rule) {
+		if deferExternal && IsExternalAPI(p.Provider.GetProviderType()) {
+			outcome.deferred = append(outcome.deferred, p)
+			continue
+		}
+
+		info := a.attempt(p)
+		if info == nil {
+			continue
+		}
+		if outcome.rule.isSufficient(info) {
+			outcome.best = info
+			outcome.done = true
+			outcome.deferred = nil
+			return outcome, nil
+		}
+		if outcome.best == nil {
+			outcome.best = info
+		}
+	}
+
+	outcome.notFound = outcome.best == nil && len(outcome.deferred) == 0 && a.notFound()
+	return outcome, nil
+}
+
+// attempter 單一 IP 的查詢狀態，同一次查詢中每個提供者最多查詢一次
+// （例如 detect provider 也在規則鏈中）
+type attempter struct {
+	r         *MultiProviderRepository
+	ctx       context.Context
+	ip        string
+	attempted map[string]*model.IPInfo
+	failed    bool // 是否有提供者因查無資料以外的原因失敗
+}
+
+// newAttempter 建立單一 IP 的查詢狀態
+func (r *MultiProviderRepository) newAttempter(ctx context.Context, ipStr string) *attempter {
+	return &attempter{
+		r:         r,
+		ctx:       ctx,
+		ip:        ipStr,
+		attempted: make(map[string]*model.IPInfo),
+	}
+}
+
+// attempt 使用提供者查詢，失敗時回傳 nil
+func (a *attempter) attempt(p *ProviderInfo) *model.IPInfo {
+	providerType := p.Provider.GetProviderType()
+	if info, ok := a.attempted[providerType]; ok {
+		return info
+	}
+	info, err := a.r.lookupWith(a.ctx, p, a.ip)
+	if err != nil {
+		if !IsNotFound(err) {
+			a.failed = true
+		}
+		info = nil
+	}
+	a.attempted[providerType] = info
+	return info
+}
+
+// notFound 已查詢的提供者是否都明確回報查無資料（斷路器開啟、配額用盡等不算）
+func (a *attempter) notFound() bool {
+	return len(a.attempted) > 0 && !a.failed
+}
+
+// matchRule 找出第一個符合的路由規則
+func (r *MultiProviderRepository) matchRule(ip net.IP, attempt func(*ProviderInfo) *model.IPInfo) *RoutingRule {
+	var geo *model.IPInfo
+	geoDetected := false
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.matchesAddress(ip) {
+			continue
+		}
+
+		if rule.needsGeo() {
+			// 只在需要時才查詢國家，CIDR / IP 版本規則不需額外查詢
+			if !geoDetected {
+				if p := r.detector(); p != nil {
+					geo = attempt(p)
+				}
+				geoDetected = true
+			}
+			if !rule.matchesGeo(geo) {
+				continue
 			}
 		}
+
+		return rule
+	}
+
+	return &defaultRoutingRule
+}
+
+// detector 取得判斷國家所用的提供者；detect provider 不健康時改用第一個健康的本地資料庫
+func (r *MultiProviderRepository) detector() *ProviderInfo {
+	p := r.getProviderInfo(r.detectProvider)
+	if p == nil || p.Health == nil || p.Health.Healthy() {
+		return p
+	}
+
+	for i := range r.providers {
+		candidate := &r.providers[i]
+		if IsExternalAPI(candidate.Provider.GetProviderType()) {
+			continue
+		}
+		if candidate.Health == nil || candidate.Health.Healthy() {
+			return candidate
+		}
 	}
+	return p
+}
+
+// defaultRoutingRule 沒有任何規則符合時，依優先級嘗試所有提供者
+var defaultRoutingRule = RoutingRule{
+	Name:     "default",
+	StopOn:   StopOnCity,
+	Fallback: FallbackRemaining,
+}
+
+// providerChain 依規則產生查詢順序：規則鏈在前，其餘提供者依優先級在後
+func (r *MultiProviderRepository) providerChain(rule *RoutingRule) []*ProviderInfo {
+	chain := make([]*ProviderInfo, 0, len(r.providers))
+	inChain := make(map[string]bool)
 
-	// 根據國家代碼選擇最佳資料庫
-	var primaryInfo *model.IPInfo
-	var primaryProvider string
+	for _, providerType := range rule.Providers {
+		if p := r.getProviderInfo(providerType); p != nil && !inChain[providerType] {
+			chain = append(chain, p)
+			inChain[providerType] = true
+		}
+	}
 
-	if countryCode == "CN" {
-		// 中國大陸：優先使用 IPIP
-		primaryProvider = "ipip"
-		primaryInfo = r.tryProvider("ipip", ipStr)
-	} else {
-		// 其他國家：優先使用 MaxMind
-		primaryProvider = "maxmind"
-		primaryInfo = maxmindInfo
-		if primaryInfo != nil {
-			primaryInfo.Provider = "maxmind"
+	if rule.Fallback == FallbackRemaining {
+		for i := range r.providers {
+			if providerType := r.providers[i].Provider.GetProviderType(); !inChain[providerType] {
+				chain = append(chain, &r.providers[i])
+				inChain[providerType] = true
+			}
 		}
 	}
 
-	// 檢查 primary 結果是否有城市資訊
-	if primaryInfo != nil && r.hasCityInfo(primaryInfo) {
-		return primaryInfo, nil
+	return demoteUnhealthy(chain)
+}
+
+// demoteUnhealthy 將不健康的提供者移到最後（維持原本的相對順序）
+func demoteUnhealthy(chain []*ProviderInfo) []*ProviderInfo {
+	healthy := make([]*ProviderInfo, 0, len(chain))
+	var unhealthy []*ProviderInfo
+	for _, p := range chain {
+		if p.Health != nil && !p.Health.Healthy() {
+			unhealthy = append(unhealthy, p)
+			continue
+		}
+		healthy = append(healthy, p)
 	}
+	return append(healthy, unhealthy...)
+}
+
+// HasBatchProvider 是否有支援批次查詢的提供者
+func (r *MultiProviderRepository) HasBatchProvider() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	// City 為空，嘗試其他所有可用的 providers
 	for _, p := range r.providers {
-		providerType := p.Provider.GetProviderType()
+		if bp, ok := p.Provider.(BatchProvider); ok && bp.SupportsBatch() {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupBatch 批次智能查詢
+// 本地資料庫逐一依路由查詢；仍不滿足停止條件的 IP 再依各自的路由順序交給外部 API，
+// 支援批次的提供者（如 ip-api）會合併成批次請求，避免逐筆消耗配額
+func (r *MultiProviderRepository) LookupBatch(ctx context.Context, ips []string) map[string]*model.IPInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make(map[string]*model.IPInfo, len(ips))
+	pending := make(map[string]*routeOutcome)
+
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			return results
+		}
 
-		// 跳過已經嘗試過的 primary provider
-		if providerType == primaryProvider {
+		outcome, err := r.route(ctx, ip, true)
+		if err != nil {
 			continue
 		}
 
-		info := r.tryProvider(providerType, ipStr)
-		if info != nil && r.hasCityInfo(info) {
-			return info, nil
+		// 先保留目前最佳結果（至少有國家資訊），再交給外部 API 補足
+		if outcome.best != nil {
+			results[ip] = outcome.best
+		}
+		if !outcome.done && len(outcome.deferred) > 0 {
+			pending[ip] = outcome
 		}
 	}
 
-	// 如果所有 provider 都沒有 city，返回 primary 結果（至少有國家資訊）
-	if primaryInfo != nil {
-		return primaryInfo, nil
+	for len(pending) > 0 && ctx.Err() == nil {
+		// 依每個 IP 的下一個外部 API 分組
+		var order []*ProviderInfo
+		groups := make(map[*ProviderInfo][]string)
+		for _, ip := range ips {
+			outcome, ok := pending[ip]
+			if !ok {
+				continue
+			}
+			head := outcome.deferred[0]
+			if _, seen := groups[head]; !seen {
+				order = append(order, head)
+			}
+			if !containsString(groups[head], ip) {
+				groups[head] = append(groups[head], ip)
+			}
+		}
+
+		for _, p := range order {
+			groupIPs := groups[p]
+
+			var found map[string]*model.IPInfo
+			if bp, ok := p.Provider.(BatchProvider); ok && bp.SupportsBatch() {
+				found = r.lookupBatchWith(ctx, p, bp, groupIPs)
+			} else {
+				found = r.lookupEachWith(ctx, p, groupIPs)
+			}
+
+			for _, ip := range groupIPs {
+				outcome := pending[ip]
+				if info, ok := found[ip]; ok && info != nil {
+					if outcome.rule.isSufficient(info) {
+						results[ip] = info
+						delete(pending, ip)
+						continue
+					}
+					if outcome.best == nil {
+						outcome.best = info
+						results[ip] = info
+					}
+				}
+
+				outcome.deferred = outcome.deferred[1:]
+				if len(outcome.deferred) == 0 {
+					delete(pending, ip)
+				}
+			}
+		}
 	}
 
-	// 所有提供者都失敗
-	return nil, ErrAllFailed
+	return results
 }
 
-// tryProvider 嘗試使用指定的 provider 查詢
-func (r *MultiProviderRepository) tryProvider(providerType, ipStr string) *model.IPInfo {
-	provider := r.getProviderByType(providerType)
-	if provider == nil {
+// lookupBatchWith 透過斷路器呼叫批次查詢
+func (r *MultiProviderRepository) lookupBatchWith(ctx context.Context, p *ProviderInfo, bp BatchProvider, ips []string) map[string]*model.IPInfo {
+	if p.Breaker != nil && !p.Breaker.Allow() {
 		return nil
 	}
 
-	info, err := provider.LookupCountry(ipStr)
-	if err == nil && info != nil {
+	start := time.Now()
+	found, err := bp.LookupBatch(ctx, ips)
+	r.recordOutcome(p, time.Since(start), err)
+
+	providerType := p.Provider.GetProviderType()
+	for _, info := range found {
 		info.Provider = providerType
-		return info
 	}
-	return nil
+	return found
 }
 
-// hasCityInfo 檢查是否有城市資訊
-func (r *MultiProviderRepository) hasCityInfo(info *model.IPInfo) bool {
-	return info.City.Name != "" || info.City.NameZh != ""
+// lookupEachWith 並行逐筆查詢不支援批次的提供者
+func (r *MultiProviderRepository) lookupEachWith(ctx context.Context, p *ProviderInfo, ips []string) map[string]*model.IPInfo {
+	found := make(map[string]*model.IPInfo, len(ips))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// 限制並行數量
+	semaphore := make(chan struct{}, 10)
+
+	for _, ip := range ips {
+		wg.Add(1)
+		go func(ipAddr string) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				return
+			}
+
+			info, err := r.lookupWith(ctx, p, ipAddr)
+			if err != nil || info == nil {
+				return
+			}
+
+			mu.Lock()
+			found[ipAddr] = info
+			mu.Unlock()
+		}(ip)
+	}
+
+	wg.Wait()
+	return found
 }
 
-// getProviderByType 根據類型取得提供者
-func (r *MultiProviderRepository) getProviderByType(providerType string) GeoIPRepository {
-	for _, p := range r.providers {
-		if p.Provider.GetProviderType() == providerType {
-			return p.Provider
+// lookupWith 透過斷路器呼叫提供者
+// 斷路器開啟時立即回傳 ErrCircuitOpen，不等待提供者逾時
+func (r *MultiProviderRepository) lookupWith(ctx context.Context, p *ProviderInfo, ipStr string) (*model.IPInfo, error) {
+	// 查詢已取消或逾時，不再呼叫提供者
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if p.Breaker != nil && !p.Breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	info, err := p.Provider.LookupCountry(ctx, ipStr)
+	r.recordOutcome(p, time.Since(start), err)
+
+	if err == nil && info != nil {
+		info.Provider = p.Provider.GetProviderType()
+	}
+	return info, err
+}
+
+// recordOutcome 將查詢結果記錄到斷路器與健康追蹤
+func (r *MultiProviderRepository) recordOutcome(p *ProviderInfo, latency time.Duration, err error) {
+	failed := isProviderFailure(err)
+
+	if p.Breaker != nil {
+		switch {
+		case failed:
+			p.Breaker.RecordFailure()
+		case errors.Is(err, ErrQuotaExceeded) || errors.Is(err, context.Canceled):
+			// 提供者沒有回應，不能作為恢復的依據
+			p.Breaker.Release()
+		default:
+			p.Breaker.RecordSuccess()
+		}
+	}
+
+	// 呼叫端取消的請求沒有完整的延遲資訊，不計入健康統計
+	if p.Health != nil && !errors.Is(err, context.Canceled) {
+		var healthErr error
+		if failed {
+			healthErr = err
+		}
+		p.Health.Record(latency, healthErr)
+	}
+}
+
+// isProviderFailure 判斷錯誤是否代表提供者故障
+// 查無資料、IP 格式錯誤、配額用盡或呼叫端取消都不是提供者故障，不計入斷路器
+func isProviderFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return !IsNotFound(err) &&
+		!errors.Is(err, ErrInvalidIP) &&
+		!errors.Is(err, ErrQuotaExceeded) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// IsNotFound 判斷錯誤是否代表提供者明確回報查無資料
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrIPNotFound) || errors.Is(err, ErrIPIPNotFound)
+}
+
+// getProviderInfo 根據類型取得提供者
+func (r *MultiProviderRepository) getProviderInfo(providerType string) *ProviderInfo {
+	for i := range r.providers {
+		if r.providers[i].Provider.GetProviderType() == providerType {
+			return &r.providers[i]
 		}
 	}
 	return nil
@@ -144,6 +543,8 @@ func (r *MultiProviderRepository) getProviderByType(providerType string) GeoIPRe
 
 // Close 關閉所有提供者的資料庫連接
 func (r *MultiProviderRepository) Close() error {
+	r.StopHealthProbes()
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -171,19 +572,13 @@ func (r *MultiProviderRepository) GetProviderType() string {
 }
 
 // LookupByProvider 使用指定的提供者查詢 IP
-func (r *MultiProviderRepository) LookupByProvider(ipStr, providerType string) (*model.IPInfo, error) {
+func (r *MultiProviderRepository) LookupByProvider(ctx context.Context, ipStr, providerType string) (*model.IPInfo, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	// 尋找指定的提供者
-	for _, p := range r.providers {
-		if p.Provider.GetProviderType() == providerType {
-			info, err := p.Provider.LookupCountry(ipStr)
-			if err == nil && info != nil {
-				info.Provider = providerType
-			}
-			return info, err
-		}
+	if p := r.getProviderInfo(providerType); p != nil {
+		return r.lookupWith(ctx, p, ipStr)
 	}
 
 	return nil, errors.New("provider not found: " + providerType)
@@ -207,3 +602,83 @@ func (r *MultiProviderRepository) GetProviders() []string {
 
 	return providers
 }
+
+// GetProviderStatuses 取得所有提供者的狀態（含斷路器、配額）
+func (r *MultiProviderRepository) GetProviderStatuses(ctx context.Context) []model.ProviderStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]model.ProviderStatus, 0, len(r.providers))
+	for _, p := range r.providers {
+		providerType := p.Provider.GetProviderType()
+		status := model.ProviderStatus{
+			Name:     providerType,
+			Kind:     ProviderKind(providerType),
+			Priority: p.Priority,
+			Region:   p.Region,
+		}
+		if p.Breaker != nil {
+			status.CircuitBreaker = p.Breaker.Status()
+		}
+		if reporter, ok := p.Provider.(QuotaReporter); ok {
+			status.Quota = reporter.QuotaStatus(ctx)
+		}
+		if p.Health != nil {
+			status.Health = p.Health.Status()
+		}
+		status.Metadata = DescribeProvider(p.Provider)
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// LookupAll 並行使用所有提供者查詢同一個 IP，結果依優先級排列
+func (r *MultiProviderRepository) LookupAll(ctx context.Context, ipStr string) []model.ProviderResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	providers := make([]*ProviderInfo, len(r.providers))
+	for i := range r.providers {
+		providers[i] = &r.providers[i]
+	}
+
+	results, _ := r.lookupConcurrent(ctx, ipStr, providers)
+	return results
+}
+
+// lookupConcurrent 並行使用指定的提供者查詢同一個 IP，結果順序與 providers 相同（需持有讀鎖）
+// errs 為各提供者的原始錯誤，供呼叫端以 IsNotFound 區分查無資料與其他失敗
+func (r *MultiProviderRepository) lookupConcurrent(ctx context.Context, ipStr string, providers []*ProviderInfo) ([]model.ProviderResult, []error) {
+	results := make([]model.ProviderResult, len(providers))
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+
+	for i, p := range providers {
+		wg.Add(1)
+		go func(idx int, p *ProviderInfo) {
+			defer wg.Done()
+
+			providerType := p.Provider.GetProviderType()
+			start := time.Now()
+
+			info, err := r.lookupWith(ctx, p, ipStr)
+
+			result := model.ProviderResult{
+				Provider:  providerType,
+				Kind:      ProviderKind(providerType),
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Result = info
+			}
+			results[idx] = result
+			errs[idx] = err
+		}(i, p)
+	}
+
+	wg.Wait()
+	return results, errs
+}
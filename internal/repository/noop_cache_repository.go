@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+// noopCacheRepository 不快取（cache.enabled = false），每次查詢都直接查詢提供者
+type noopCacheRepository struct{}
+
+// NewNoopCacheRepository 建立不快取的 Cache repository
+func NewNoopCacheRepository() CacheRepository {
+	return noopCacheRepository{}
+}
+
+// Get 不快取，永遠未命中
+func (noopCacheRepository) Get(ctx context.Context, ip string) (*CacheEntry, error) {
+	return nil, ErrCacheMiss
+}
+
+// Set 不寫入
+func (noopCacheRepository) Set(ctx context.Context, ip string, info *model.IPInfo, ttl time.Duration) error {
+	return nil
+}
+
+// SetNotFound 不寫入
+func (noopCacheRepository) SetNotFound(ctx context.Context, ip string, ttl time.Duration) error {
+	return nil
+}
+
+// MGet 不快取，回傳空結果（全部未命中）
+func (noopCacheRepository) MGet(ctx context.Context, ips []string) (map[string]*CacheEntry, error) {
+	return make(map[string]*CacheEntry), nil
+}
+
+// MSet 不寫入
+func (noopCacheRepository) MSet(ctx context.Context, items map[string]*model.IPInfo, ttl time.Duration) error {
+	return nil
+}
+
+// Delete 沒有可刪除的快取
+func (noopCacheRepository) Delete(ctx context.Context, ips ...string) error {
+	return nil
+}
+
+// UseDatasetVersion 不記錄資料集版本，回傳空字串（視為版本未改變）
+func (noopCacheRepository) UseDatasetVersion(ctx context.Context, version string) (string, error) {
+	return "", nil
+}
+
+// DatasetVersion 不使用資料集版本
+func (noopCacheRepository) DatasetVersion() string {
+	return ""
+}
+
+// DeleteDatasetVersion 沒有可刪除的快取
+func (noopCacheRepository) DeleteDatasetVersion(ctx context.Context, version string) (int64, error) {
+	return 0, nil
+}
+
+// IncrHotIPs 不記錄查詢次數
+func (noopCacheRepository) IncrHotIPs(ctx context.Context, counts map[string]float64) error {
+	return nil
+}
+
+// HotIPs 沒有查詢次數記錄
+func (noopCacheRepository) HotIPs(ctx context.Context, limit int) ([]string, error) {
+	return nil, nil
+}
+
+// Inspect 不快取，永遠未命中
+func (noopCacheRepository) Inspect(ctx context.Context, ip string) (*model.CacheEntryDetail, error) {
+	return nil, ErrCacheMiss
+}
+
+// FlushMatching 沒有可刪除的快取
+func (noopCacheRepository) FlushMatching(ctx context.Context, filter CacheFilter, progress *FlushProgress) error {
+	return nil
+}
+
+// Exists 不快取，永遠不存在
+func (noopCacheRepository) Exists(ctx context.Context, ip string) (bool, error) {
+	return false, nil
+}
+
+// FlushAll 沒有可清除的快取
+func (noopCacheRepository) FlushAll(ctx context.Context) error {
+	return nil
+}
+
+// GetStats 只回傳後端名稱
+func (noopCacheRepository) GetStats(ctx context.Context) (*model.CacheStats, error) {
+	return &model.CacheStats{Backend: "none"}, nil
+}
+
+// Close 沒有需要釋放的資源
+func (noopCacheRepository) Close() error {
+	return nil
+}
+
+// HealthCheck 不快取，永遠健康
+func (noopCacheRepository) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Backend 快取後端名稱（none）
+func (noopCacheRepository) Backend() string {
+	return "none"
+}
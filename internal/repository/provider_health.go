@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+const (
+	// healthSampleSize 每個提供者保留的最近樣本數
+	healthSampleSize = 256
+
+	// healthEvalInterval 健康狀態重新計算的最短間隔，避免每次查詢都排序延遲
+	healthEvalInterval = time.Second
+)
+
+// HealthSettings 提供者健康追蹤參數
+type HealthSettings struct {
+	Window        time.Duration // 統計窗口，只計算窗口內的樣本
+	MinSamples    int           // 判斷健康狀態前的最少樣本數
+	MaxErrorRate  float64       // 錯誤率超過此值時降級（0 表示不使用）
+	MaxP95Latency time.Duration // p95 延遲超過此值時降級（0 表示不使用）
+}
+
+// healthSample 單次查詢樣本
+type healthSample struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// ProviderHealth 單一提供者的健康追蹤：記錄最近的錯誤率與延遲，
+// 不健康的提供者會在路由順序中降級，並由背景探測確認恢復
+type ProviderHealth struct {
+	settings HealthSettings
+
+	mu          sync.Mutex
+	samples     [healthSampleSize]healthSample
+	next        int
+	count       int
+	healthy     bool
+	errorRate   float64
+	p95         time.Duration
+	windowCount int
+	evaluatedAt time.Time
+	changedAt   time.Time
+	lastError   string
+	lastProbeAt time.Time
+}
+
+// NewProviderHealth 建立新的提供者健康追蹤
+func NewProviderHealth(settings HealthSettings) *ProviderHealth {
+	if settings.Window <= 0 {
+		settings.Window = 5 * time.Minute
+	}
+	if settings.MinSamples <= 0 {
+		settings.MinSamples = 1
+	}
+
+	return &ProviderHealth{
+		settings:  settings,
+		healthy:   true,
+		changedAt: time.Now(),
+	}
+}
+
+// Record 記錄一次查詢結果（err 應已排除查無資料等非故障錯誤）
+func (h *ProviderHealth) Record(latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.samples[h.next] = healthSample{at: now, latency: latency, failed: err != nil}
+	h.next = (h.next + 1) % healthSampleSize
+	if h.count < healthSampleSize {
+		h.count++
+	}
+	if err != nil {
+		h.lastError = err.Error()
+	}
+
+	if now.Sub(h.evaluatedAt) >= healthEvalInterval || (err != nil && h.healthy) {
+		h.evaluate(now)
+	}
+}
+
+// Healthy 提供者目前是否健康
+func (h *ProviderHealth) Healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.healthy
+}
+
+// RecordProbe 記錄探測結果：探測成功代表提供者已恢復，清除舊樣本並恢復為健康
+func (h *ProviderHealth) RecordProbe(latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.lastProbeAt = now
+
+	if err != nil {
+		h.lastError = err.Error()
+		return
+	}
+
+	h.samples[0] = healthSample{at: now, latency: latency}
+	h.next, h.count = 1, 1
+	h.evaluate(now)
+	if !h.healthy {
+		h.healthy = true
+		h.changedAt = now
+	}
+}
+
+// Status 取得健康狀態快照
+func (h *ProviderHealth) Status() *model.ProviderHealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.evaluate(time.Now())
+
+	status := &model.ProviderHealthStatus{
+		Status:       "healthy",
+		ErrorRate:    math.Round(h.errorRate*1000) / 1000,
+		P95LatencyMs: float64(h.p95.Microseconds()) / 1000.0,
+		Samples:      h.windowCount,
+		Since:        h.changedAt,
+		LastError:    h.lastError,
+	}
+	if !h.healthy {
+		status.Status = "unhealthy"
+	}
+	if !h.lastProbeAt.IsZero() {
+		lastProbeAt := h.lastProbeAt
+		status.LastProbeAt = &lastProbeAt
+	}
+
+	return status
+}
+
+// evaluate 重新計算窗口內的錯誤率與 p95 延遲並更新健康狀態（需持有鎖）
+func (h *ProviderHealth) evaluate(now time.Time) {
+	h.evaluatedAt = now
+
+	cutoff := now.Add(-h.settings.Window)
+	latencies := make([]time.Duration, 0, h.count)
+	failures := 0
+	for i := 0; i < h.count; i++ {
+		s := h.samples[i]
+		if s.at.Before(cutoff) {
+			continue
+		}
+		latencies = append(latencies, s.latency)
+		if s.failed {
+			failures++
+		}
+	}
+
+	h.windowCount = len(latencies)
+	h.errorRate = 0
+	h.p95 = 0
+	if len(latencies) > 0 {
+		h.errorRate = float64(failures) / float64(len(latencies))
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		h.p95 = latencies[(len(latencies)*95+99)/100-1]
+	}
+
+	// 樣本不足時維持原狀態
+	if h.windowCount < h.settings.MinSamples {
+		return
+	}
+
+	healthy := true
+	if h.settings.MaxErrorRate > 0 && h.errorRate >= h.settings.MaxErrorRate {
+		healthy = false
+	}
+	if h.settings.MaxP95Latency > 0 && h.p95 >= h.settings.MaxP95Latency {
+		healthy = false
+	}
+
+	if healthy != h.healthy {
+		h.healthy = healthy
+		h.changedAt = now
+	}
+}
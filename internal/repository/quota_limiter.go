@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	quotaKeyPrefix = "goip:quota:"
+
+	// quotaRedisTimeout Redis 配額檢查的逾時，避免 Redis 異常時拖慢查詢
+	quotaRedisTimeout = 500 * time.Millisecond
+)
+
+var (
+	ErrQuotaExceeded = errors.New("provider quota exhausted")
+)
+
+// reserveQuotaScript 原子地檢查所有窗口並遞增計數
+// 任一窗口已達上限時不遞增，回傳該窗口的索引（從 1 開始）；成功回傳 0
+var reserveQuotaScript = redis.NewScript(`
+local n = #KEYS
+for i = 1, n do
+	local used = tonumber(redis.call('GET', KEYS[i]) or '0')
+	if used >= tonumber(ARGV[i]) then
+		return i
+	end
+end
+for i = 1, n do
+	redis.call('INCR', KEYS[i])
+	if redis.call('TTL', KEYS[i]) < 0 then
+		redis.call('EXPIRE', KEYS[i], ARGV[n + i])
+	end
+end
+return 0
+`)
+
+// QuotaLimits 配額上限（0 或負數表示該窗口不限制）
+type QuotaLimits struct {
+	PerMinute int
+	PerDay    int
+	PerMonth  int
+}
+
+// quotaWindow 單一配額窗口
+type quotaWindow struct {
+	name  string
+	limit int
+}
+
+// localQuotaCount 本地計數（Redis 不可用時使用）
+type localQuotaCount struct {
+	bucket string
+	used   int64
+}
+
+// QuotaLimiter 外部 API 配額限制器
+// 計數存放在 Redis，多個實例共用同一份額度；Redis 不可用時退回本地計數
+type QuotaLimiter struct {
+	provider string
+	windows  []quotaWindow
+	client   redis.UniversalClient
+
+	mu    sync.Mutex
+	local map[string]*localQuotaCount
+}
+
+// NewQuotaLimiter 建立新的配額限制器（client 為 nil 時只使用本地計數）
+func NewQuotaLimiter(provider string, limits QuotaLimits, client redis.UniversalClient) *QuotaLimiter {
+	var windows []quotaWindow
+	if limits.PerMinute > 0 {
+		windows = append(windows, quotaWindow{name: "minute", limit: limits.PerMinute})
+	}
+	if limits.PerDay > 0 {
+		windows = append(windows, quotaWindow{name: "day", limit: limits.PerDay})
+	}
+	if limits.PerMonth > 0 {
+		windows = append(windows, quotaWindow{name: "month", limit: limits.PerMonth})
+	}
+
+	return &QuotaLimiter{
+		provider: provider,
+		windows:  windows,
+		client:   client,
+		local:    make(map[string]*localQuotaCount),
+	}
+}
+
+// Reserve 預扣一次配額，任一窗口用盡時回傳 ErrQuotaExceeded
+func (q *QuotaLimiter) Reserve(ctx context.Context) error {
+	if len(q.windows) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	if q.client != nil {
+		exceeded, err := q.reserveRedis(ctx, now)
+		if err == nil {
+			if exceeded != "" {
+				return fmt.Errorf("%s %s quota: %w", q.provider, exceeded, ErrQuotaExceeded)
+			}
+			return nil
+		}
+		// Redis 失敗時退回本地計數
+	}
+
+	if exceeded := q.reserveLocal(now); exceeded != "" {
+		return fmt.Errorf("%s %s quota: %w", q.provider, exceeded, ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// Status 取得目前配額使用狀況
+func (q *QuotaLimiter) Status(ctx context.Context) *model.QuotaStatus {
+	now := time.Now().UTC()
+	status := &model.QuotaStatus{
+		Windows: make([]model.QuotaWindowStatus, 0, len(q.windows)),
+	}
+
+	used := make([]int64, len(q.windows))
+	fromRedis := false
+
+	if q.client != nil {
+		ctx, cancel := context.WithTimeout(ctx, quotaRedisTimeout)
+		defer cancel()
+
+		keys := make([]string, len(q.windows))
+		for i, w := range q.windows {
+			keys[i] = q.key(w.name, now)
+		}
+
+		values, err := q.client.MGet(ctx, keys...).Result()
+		if err == nil {
+			fromRedis = true
+			for i, v := range values {
+				if s, ok := v.(string); ok {
+					fmt.Sscanf(s, "%d", &used[i])
+				}
+			}
+		}
+	}
+
+	if !fromRedis {
+		q.mu.Lock()
+		for i, w := range q.windows {
+			if c, ok := q.local[w.name]; ok && c.bucket == bucketID(w.name, now) {
+				used[i] = c.used
+			}
+		}
+		q.mu.Unlock()
+	}
+
+	for i, w := range q.windows {
+		remaining := int64(w.limit) - used[i]
+		if remaining <= 0 {
+			remaining = 0
+			status.Exhausted = true
+		}
+		status.Windows = append(status.Windows, model.QuotaWindowStatus{
+			Window:    w.name,
+			Limit:     w.limit,
+			Used:      used[i],
+			Remaining: remaining,
+			ResetAt:   windowReset(w.name, now),
+		})
+	}
+
+	return status
+}
+
+// reserveRedis 在 Redis 中預扣配額，回傳已用盡的窗口名稱
+func (q *QuotaLimiter) reserveRedis(ctx context.Context, now time.Time) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, quotaRedisTimeout)
+	defer cancel()
+
+	n := len(q.windows)
+	keys := make([]string, n)
+	args := make([]interface{}, 2*n)
+	for i, w := range q.windows {
+		keys[i] = q.key(w.name, now)
+		args[i] = w.limit
+		// 多保留一分鐘，避免窗口邊界時計數提前消失
+		args[n+i] = int64(windowReset(w.name, now).Sub(now).Seconds()) + 60
+	}
+
+	idx, err := reserveQuotaScript.Run(ctx, q.client, keys, args...).Int()
+	if err != nil {
+		return "", err
+	}
+	if idx > 0 {
+		return q.windows[idx-1].name, nil
+	}
+	return "", nil
+}
+
+// reserveLocal 在本地預扣配額，回傳已用盡的窗口名稱
+func (q *QuotaLimiter) reserveLocal(now time.Time) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, w := range q.windows {
+		bucket := bucketID(w.name, now)
+		c, ok := q.local[w.name]
+		if !ok || c.bucket != bucket {
+			c = &localQuotaCount{bucket: bucket}
+			q.local[w.name] = c
+		}
+		if c.used >= int64(w.limit) {
+			return w.name
+		}
+	}
+
+	for _, w := range q.windows {
+		q.local[w.name].used++
+	}
+	return ""
+}
+
+// key 產生 Redis 鍵，使用 hash tag 讓同一提供者的窗口落在同一個 slot
+func (q *QuotaLimiter) key(window string, now time.Time) string {
+	return quotaKeyPrefix + "{" + q.provider + "}:" + window + ":" + bucketID(window, now)
+}
+
+// bucketID 取得時間所屬的窗口編號（UTC）
+func bucketID(window string, now time.Time) string {
+	switch window {
+	case "minute":
+		return now.Format("200601021504")
+	case "day":
+		return now.Format("20060102")
+	default:
+		return now.Format("200601")
+	}
+}
+
+// windowReset 取得窗口重置時間（UTC）
+func windowReset(window string, now time.Time) time.Time {
+	switch window {
+	case "minute":
+		return now.Truncate(time.Minute).Add(time.Minute)
+	case "day":
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
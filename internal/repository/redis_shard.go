@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanDeleteBatch 每批刪除的鍵數量
+const scanDeleteBatch = 1000
+
+// forEachShard 在每個 master 節點上執行 fn：cluster 模式並行執行於所有 master，
+// standalone / sentinel 模式只有一個節點。SCAN、DBSIZE、INFO 等不帶鍵的命令需逐一節點執行
+func forEachShard(ctx context.Context, client redis.UniversalClient, fn func(ctx context.Context, shard redis.UniversalClient) error) error {
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, shard *redis.Client) error {
+			return fn(ctx, shard)
+		})
+	}
+	return fn(ctx, client)
+}
+
+// ScanDelete 在每個節點以 SCAN 找出符合 pattern 的鍵並批次刪除，回傳刪除數量
+// 同一節點的鍵可能分屬不同 slot，因此以 pipeline 逐鍵刪除，避免 CROSSSLOT 錯誤
+func ScanDelete(ctx context.Context, client redis.UniversalClient, pattern string) (int64, error) {
+	var deleted int64
+
+	err := forEachShard(ctx, client, func(ctx context.Context, shard redis.UniversalClient) error {
+		iter := shard.Scan(ctx, 0, pattern, 0).Iterator()
+		var keys []string
+
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+			// 批次刪除，避免一次刪除太多
+			if len(keys) >= scanDeleteBatch {
+				n, err := deleteKeys(ctx, shard, keys)
+				atomic.AddInt64(&deleted, n)
+				if err != nil {
+					return err
+				}
+				keys = keys[:0]
+			}
+		}
+
+		if err := iter.Err(); err != nil {
+			return err
+		}
+
+		// 刪除剩餘的鍵
+		n, err := deleteKeys(ctx, shard, keys)
+		atomic.AddInt64(&deleted, n)
+		return err
+	})
+
+	return atomic.LoadInt64(&deleted), err
+}
+
+// deleteKeys 以 pipeline 逐鍵刪除，回傳刪除數量
+func deleteKeys(ctx context.Context, client redis.UniversalClient, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Del(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+	return deleted, err
+}
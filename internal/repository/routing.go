@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/shengjhe/goip/internal/model"
+)
+
+const (
+	// StopOnCity 取得城市資訊才停止（預設）
+	StopOnCity = "city"
+	// StopOnCountry 取得國家資訊即停止
+	StopOnCountry = "country"
+
+	// FallbackRemaining 規則鏈都無法滿足時，依優先級嘗試其餘提供者（預設）
+	FallbackRemaining = "remaining"
+	// FallbackNone 只使用規則鏈中的提供者
+	FallbackNone = "none"
+
+	// defaultDetectProvider 預設用來判斷國家與大洲的提供者
+	defaultDetectProvider = "maxmind"
+)
+
+// RoutingRule 路由規則：符合條件的 IP 依 Providers 順序查詢
+// 所有條件皆為 AND；未設定的條件視為符合
+type RoutingRule struct {
+	Name       string
+	Countries  []string     // ISO 國碼，例如 CN, HK
+	Continents []string     // 大洲代碼，例如 EU, AS
+	IPVersion  int          // 4 或 6，0 表示不限
+	Networks   []*net.IPNet // CIDR 列表
+	Providers  []string     // 依序查詢的提供者
+	StopOn     string       // city / country
+	Fallback   string       // remaining / none
+}
+
+// RoutingTable 路由表
+type RoutingTable struct {
+	DetectProvider string        // 判斷國家與大洲所用的提供者
+	Rules          []RoutingRule // 依序比對，第一個符合的規則生效
+}
+
+// NewRoutingRule 建立路由規則並檢查參數
+func NewRoutingRule(name string, countries, continents []string, ipVersion int, cidrs, providers []string, stopOn, fallback string) (RoutingRule, error) {
+	rule := RoutingRule{
+		Name:       name,
+		Countries:  upperAll(countries),
+		Continents: upperAll(continents),
+		IPVersion:  ipVersion,
+		Providers:  providers,
+		StopOn:     stopOn,
+		Fallback:   fallback,
+	}
+
+	if rule.StopOn == "" {
+		rule.StopOn = StopOnCity
+	}
+	if rule.Fallback == "" {
+		rule.Fallback = FallbackRemaining
+	}
+
+	if rule.StopOn != StopOnCity && rule.StopOn != StopOnCountry {
+		return rule, fmt.Errorf("routing rule %q: invalid stop_on %q", name, stopOn)
+	}
+	if rule.Fallback != FallbackRemaining && rule.Fallback != FallbackNone {
+		return rule, fmt.Errorf("routing rule %q: invalid fallback %q", name, fallback)
+	}
+	if rule.IPVersion != 0 && rule.IPVersion != 4 && rule.IPVersion != 6 {
+		return rule, fmt.Errorf("routing rule %q: invalid ip_version %d", name, ipVersion)
+	}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return rule, fmt.Errorf("routing rule %q: invalid cidr %q: %w", name, cidr, err)
+		}
+		rule.Networks = append(rule.Networks, network)
+	}
+
+	return rule, nil
+}
+
+// needsGeo 規則是否需要先判斷國家或大洲
+func (rule *RoutingRule) needsGeo() bool {
+	return len(rule.Countries) > 0 || len(rule.Continents) > 0
+}
+
+// matchesAddress 比對 IP 版本與 CIDR 條件
+func (rule *RoutingRule) matchesAddress(ip net.IP) bool {
+	if rule.IPVersion == 4 && ip.To4() == nil {
+		return false
+	}
+	if rule.IPVersion == 6 && ip.To4() != nil {
+		return false
+	}
+
+	if len(rule.Networks) > 0 {
+		matched := false
+		for _, network := range rule.Networks {
+			if network.Contains(ip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesGeo 比對國家與大洲條件（geo 為判斷用的查詢結果，可能為 nil）
+func (rule *RoutingRule) matchesGeo(geo *model.IPInfo) bool {
+	if len(rule.Countries) > 0 {
+		if geo == nil || !containsString(rule.Countries, strings.ToUpper(geo.Country.ISOCode)) {
+			return false
+		}
+	}
+
+	if len(rule.Continents) > 0 {
+		if geo == nil || geo.Continent == nil || !containsString(rule.Continents, strings.ToUpper(geo.Continent.Code)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isSufficient 判斷結果是否滿足規則的停止條件
+func (rule *RoutingRule) isSufficient(info *model.IPInfo) bool {
+	if rule.StopOn == StopOnCountry {
+		return info.Country.ISOCode != "" || info.Country.Name != ""
+	}
+	return info.City.Name != "" || info.City.NameZh != ""
+}
+
+// legacyRoutingRules 未設定路由規則時，依提供者的 region 產生與舊版相同的路由：
+// 中國大陸 IP 優先使用 region=cn 的提供者，其他 IP 優先使用 region=global 的提供者，
+// 城市資訊不足時再依優先級嘗試其餘提供者
+func legacyRoutingRules(providers []ProviderInfo) []RoutingRule {
+	var cnChain, globalChain []string
+	for _, p := range providers {
+		switch p.Region {
+		case "cn":
+			cnChain = append(cnChain, p.Provider.GetProviderType())
+		case "global":
+			globalChain = append(globalChain, p.Provider.GetProviderType())
+		}
+	}
+
+	return []RoutingRule{
+		{
+			Name:      "legacy-cn",
+			Countries: []string{"CN"},
+			Providers: cnChain,
+			StopOn:    StopOnCity,
+			Fallback:  FallbackRemaining,
+		},
+		{
+			Name:      "legacy-global",
+			Providers: globalChain,
+			StopOn:    StopOnCity,
+			Fallback:  FallbackRemaining,
+		},
+	}
+}
+
+// upperAll 轉換為大寫
+func upperAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// containsString 檢查字串是否存在於列表中
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
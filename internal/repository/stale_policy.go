@@ -0,0 +1,73 @@
+package repository
+
+import "time"
+
+// Freshness 快取項目的新鮮度
+type Freshness int
+
+const (
+	// Fresh 在 soft TTL 內
+	Fresh Freshness = iota
+	// RefreshAhead 仍在 soft TTL 內但即將到期，應在背景提前更新
+	RefreshAhead
+	// Stale 已超過 soft TTL 但未超過 hard TTL，可先回傳舊資料並在背景更新
+	Stale
+)
+
+// String 新鮮度名稱
+func (f Freshness) String() string {
+	switch f {
+	case RefreshAhead:
+		return "refresh_ahead"
+	case Stale:
+		return "stale"
+	default:
+		return "fresh"
+	}
+}
+
+// StaleSettings 單一資料來源的 stale-while-revalidate 設定
+type StaleSettings struct {
+	StaleTTL     time.Duration // soft TTL 到期後仍可回傳舊資料的時間（hard TTL = soft TTL + StaleTTL）
+	RefreshAhead time.Duration // soft TTL 到期前多久開始在被查詢時提前更新（0 表示不提前）
+}
+
+// StalePolicy 依資料來源（db / api）的 stale-while-revalidate 設定，零值表示不使用
+type StalePolicy struct {
+	DB  StaleSettings
+	API StaleSettings
+}
+
+// forSource 取得資料來源的設定
+func (p StalePolicy) forSource(source string) StaleSettings {
+	if source == "api" {
+		return p.API
+	}
+	return p.DB
+}
+
+// hardTTL 依 soft TTL 與資料來源計算 Redis 實際的過期時間
+func (p StalePolicy) hardTTL(source string, ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	return ttl + p.forSource(source).StaleTTL
+}
+
+// freshness 依 Redis 剩餘 TTL 判斷新鮮度：剩餘時間落在 stale 區間內表示已超過 soft TTL
+func (p StalePolicy) freshness(source string, remaining time.Duration) Freshness {
+	// 沒有過期時間（-1）或已不存在（-2）
+	if remaining < 0 {
+		return Fresh
+	}
+
+	settings := p.forSource(source)
+	switch {
+	case remaining <= settings.StaleTTL && settings.StaleTTL > 0:
+		return Stale
+	case remaining <= settings.StaleTTL+settings.RefreshAhead && settings.RefreshAhead > 0:
+		return RefreshAhead
+	default:
+		return Fresh
+	}
+}
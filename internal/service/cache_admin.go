@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/shengjhe/goip/internal/repository"
+)
+
+var (
+	ErrFlushRunning       = errors.New("cache flush already running")
+	ErrInvalidFlushFilter = errors.New("invalid cache flush filter")
+)
+
+// flushJob 進行中或最近一次的選擇性清除
+type flushJob struct {
+	mu       sync.Mutex
+	status   model.CacheFlushStatus
+	progress *repository.FlushProgress
+}
+
+// snapshot 取得目前進度的副本
+func (j *flushJob) snapshot() *model.CacheFlushStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	if j.progress != nil {
+		status.Scanned = atomic.LoadInt64(&j.progress.Scanned)
+		status.Matched = atomic.LoadInt64(&j.progress.Matched)
+		status.Deleted = atomic.LoadInt64(&j.progress.Deleted)
+	}
+	return &status
+}
+
+// InspectCache 取得單一 IP 在指定查詢模式下的快取項目，未快取時回傳 repository.ErrCacheMiss
+func (s *ipService) InspectCache(ctx context.Context, ip string, mode string) (*model.CacheEntryDetail, error) {
+	if !repository.IsValidLookupMode(mode) {
+		return nil, fmt.Errorf("%w: %s", repository.ErrUnknownMode, mode)
+	}
+	if net.ParseIP(ip) == nil {
+		return nil, repository.ErrInvalidIP
+	}
+	return s.cache.Inspect(ctx, cacheKey(mode, ip))
+}
+
+// FlushCache 在背景以 SCAN 刪除符合條件的快取；已有進行中的清除時回傳 ErrFlushRunning
+func (s *ipService) FlushCache(ctx context.Context, req model.CacheFlushRequest) (*model.CacheFlushStatus, error) {
+	filter, err := parseFlushFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.flush.mu.Lock()
+	defer s.flush.mu.Unlock()
+
+	if s.flush.status.Running {
+		return nil, ErrFlushRunning
+	}
+
+	now := time.Now()
+	progress := &repository.FlushProgress{}
+	s.flush.progress = progress
+	s.flush.status = model.CacheFlushStatus{
+		Running:   true,
+		Filter:    req,
+		StartedAt: &now,
+	}
+
+	s.logger.Info().Interface("filter", req).Msg("Cache flush started")
+	go s.runFlush(filter, progress)
+
+	status := s.flush.status
+	return &status, nil
+}
+
+// FlushStatus 取得進行中或最近一次清除的進度
+func (s *ipService) FlushStatus() *model.CacheFlushStatus {
+	return s.flush.snapshot()
+}
+
+// runFlush 執行清除並記錄結果
+func (s *ipService) runFlush(filter repository.CacheFilter, progress *repository.FlushProgress) {
+	err := s.cache.FlushMatching(context.Background(), filter, progress)
+
+	s.flush.mu.Lock()
+	now := time.Now()
+	s.flush.status.Running = false
+	s.flush.status.FinishedAt = &now
+	if err != nil {
+		s.flush.status.Error = err.Error()
+	}
+	s.flush.mu.Unlock()
+
+	status := s.flush.snapshot()
+	s.logger.Info().
+		Int64("scanned", status.Scanned).
+		Int64("matched", status.Matched).
+		Int64("deleted", status.Deleted).
+		Str("error", status.Error).
+		Msg("Cache flush finished")
+}
+
+// parseFlushFilter 驗證清除條件：至少需要一個條件，all 不可與其他條件同時使用
+func parseFlushFilter(req model.CacheFlushRequest) (repository.CacheFilter, error) {
+	filter := repository.CacheFilter{
+		Provider: strings.TrimSpace(req.Provider),
+		Source:   strings.TrimSpace(req.Source),
+		Country:  strings.TrimSpace(req.Country),
+		All:      req.All,
+	}
+	cidr := strings.TrimSpace(req.CIDR)
+	hasCriteria := cidr != "" || filter.Provider != "" || filter.Source != "" || filter.Country != ""
+
+	if req.All {
+		if hasCriteria {
+			return filter, fmt.Errorf("%w: all cannot be combined with other filters", ErrInvalidFlushFilter)
+		}
+		return filter, nil
+	}
+	if !hasCriteria {
+		return filter, fmt.Errorf("%w: at least one of cidr, provider, source, country or all is required", ErrInvalidFlushFilter)
+	}
+
+	if cidr != "" {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return filter, fmt.Errorf("%w: invalid cidr %q", ErrInvalidFlushFilter, cidr)
+		}
+		// 快取鍵中的 IPv4-mapped 位址比對時已轉為 IPv4
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		filter.Prefix = prefix.Masked()
+	}
+	if filter.Source != "" && filter.Source != "db" && filter.Source != "api" {
+		return filter, fmt.Errorf("%w: source must be db or api", ErrInvalidFlushFilter)
+	}
+	return filter, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/shengjhe/goip/internal/repository"
+)
+
+// lookupCall 進行中的單一快取鍵查詢
+type lookupCall struct {
+	done chan struct{}
+	info *model.IPInfo
+	err  error
+}
+
+// wait 等待查詢完成，呼叫端取消時提前返回；回傳結果的副本，避免多個請求共用同一個物件
+func (c *lookupCall) wait(ctx context.Context) (*model.IPInfo, error) {
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	// leader 沒有回傳結果也沒有錯誤時視為查無資料
+	if c.info == nil {
+		return nil, repository.ErrIPNotFound
+	}
+	info := *c.info
+	return &info, nil
+}
+
+// lookupGroup 合併同一快取鍵的並行查詢：同一時間只有一個請求（leader）查詢提供者並寫入快取，
+// 其餘請求等待並共用結果
+type lookupGroup struct {
+	mu    sync.Mutex
+	calls map[string]*lookupCall
+}
+
+// join 加入 key 進行中的查詢；沒有進行中的查詢時建立新的查詢並回傳 leader = true，
+// 由呼叫端查詢後以 finish 回報結果
+func (g *lookupGroup) join(key string) (*lookupCall, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+
+	if g.calls == nil {
+		g.calls = make(map[string]*lookupCall)
+	}
+	c := &lookupCall{done: make(chan struct{})}
+	g.calls[key] = c
+	return c, true
+}
+
+// finish 回報查詢結果並喚醒等待的請求
+func (g *lookupGroup) finish(key string, c *lookupCall, info *model.IPInfo, err error) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	c.info, c.err = info, err
+	close(c.done)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/shengjhe/goip/internal/repository"
+	"github.com/shengjhe/goip/pkg/geo"
+)
+
+// CompareProviders 並行查詢所有提供者，並計算結果一致性
+func (s *ipService) CompareProviders(ctx context.Context, ip string) (*model.CompareResult, error) {
+	startTime := time.Now()
+	atomic.AddUint64(&s.stats.totalQueries, 1)
+
+	if net.ParseIP(ip) == nil {
+		atomic.AddUint64(&s.stats.totalErrors, 1)
+		return nil, repository.ErrInvalidIP
+	}
+
+	lookupCtx, cancel := s.withLookupTimeout(ctx)
+	defer cancel()
+
+	var results []model.ProviderResult
+	if multiRepo, ok := s.geoip.(*repository.MultiProviderRepository); ok {
+		results = multiRepo.LookupAll(lookupCtx, ip)
+	} else {
+		// 單一提供者：直接查詢
+		providerType := s.geoip.GetProviderType()
+		result := model.ProviderResult{
+			Provider: providerType,
+			Kind:     repository.ProviderKind(providerType),
+		}
+		info, err := s.geoip.LookupCountry(lookupCtx, ip)
+		result.LatencyMs = time.Since(startTime).Milliseconds()
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			info.Provider = providerType
+			result.Result = info
+		}
+		results = []model.ProviderResult{result}
+	}
+
+	for i := range results {
+		if info := results[i].Result; info != nil {
+			info.Source = results[i].Kind
+		}
+	}
+
+	s.recordQueryTime(startTime)
+
+	return &model.CompareResult{
+		IP:          ip,
+		Results:     results,
+		Agreement:   buildAgreement(results),
+		QueryTimeMs: time.Since(startTime).Milliseconds(),
+	}, nil
+}
+
+// buildAgreement 計算各提供者結果的一致性
+// 國家以 ISO 國碼比對；城市以英文或中文名稱（不分大小寫）比對；
+// 有經緯度的提供者兩兩計算距離
+func buildAgreement(results []model.ProviderResult) model.AgreementSummary {
+	summary := model.AgreementSummary{
+		Countries: make(map[string][]string),
+		Cities:    make(map[string][]string),
+	}
+
+	var cityResults []*model.IPInfo
+	var located []*model.IPInfo
+
+	for i := range results {
+		info := results[i].Result
+		if info == nil {
+			continue
+		}
+
+		if code := strings.ToUpper(info.Country.ISOCode); code != "" {
+			summary.Countries[code] = append(summary.Countries[code], info.Provider)
+		}
+
+		if name := cityDisplayName(info); name != "" {
+			summary.Cities[name] = append(summary.Cities[name], info.Provider)
+			cityResults = append(cityResults, info)
+		}
+
+		if info.Location != nil && (info.Location.Latitude != 0 || info.Location.Longitude != 0) {
+			located = append(located, info)
+		}
+	}
+
+	summary.CountryMatch = len(summary.Countries) == 1
+
+	summary.CityMatch = len(cityResults) > 0
+	for i := 1; i < len(cityResults); i++ {
+		if !sameCity(cityResults[0], cityResults[i]) {
+			summary.CityMatch = false
+			break
+		}
+	}
+
+	for i := 0; i < len(located); i++ {
+		for j := i + 1; j < len(located); j++ {
+			a, b := located[i], located[j]
+			distance := geo.DistanceKm(a.Location.Latitude, a.Location.Longitude, b.Location.Latitude, b.Location.Longitude)
+			distance = float64(int64(distance*10+0.5)) / 10 // 取到小數第一位
+
+			summary.Distances = append(summary.Distances, model.ProviderDistance{
+				From:       a.Provider,
+				To:         b.Provider,
+				DistanceKm: distance,
+			})
+			if distance > summary.MaxDistanceKm {
+				summary.MaxDistanceKm = distance
+			}
+		}
+	}
+
+	return summary
+}
+
+// cityDisplayName 取得城市顯示名稱（英文優先）
+func cityDisplayName(info *model.IPInfo) string {
+	if info.City.Name != "" {
+		return info.City.Name
+	}
+	return info.City.NameZh
+}
+
+// sameCity 判斷兩筆結果是否為同一城市（任一名稱相同即視為一致）
+func sameCity(a, b *model.IPInfo) bool {
+	namesA := []string{a.City.Name, a.City.NameZh}
+	namesB := []string{b.City.Name, b.City.NameZh}
+
+	for _, na := range namesA {
+		if na == "" {
+			continue
+		}
+		for _, nb := range namesB {
+			if nb != "" && strings.EqualFold(na, nb) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,40 +2,78 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/shengjhe/goip/internal/model"
 	"github.com/shengjhe/goip/internal/repository"
-	"github.com/redis/go-redis/v9"
+	"github.com/shengjhe/goip/pkg/validator"
 	"github.com/rs/zerolog"
 )
 
 // IPService IP 查詢服務介面
 type IPService interface {
 	LookupIP(ctx context.Context, ip string) (*model.IPInfo, error)
+	LookupIPWithMode(ctx context.Context, ip string, mode string) (*model.IPInfo, error)
 	LookupIPByProvider(ctx context.Context, ip string, provider string) (*model.IPInfo, error)
 	BatchLookup(ctx context.Context, ips []string) (*model.BatchResult, error)
+	CompareProviders(ctx context.Context, ip string) (*model.CompareResult, error)
 	GetStats() *model.ServiceStats
-	InvalidateCache(ctx context.Context, ips ...string) error
+	InvalidateCache(ctx context.Context, provider string, ips ...string) error
 	GetAvailableProviders() []string
+	GetProviderStatuses(ctx context.Context) []model.ProviderStatus
+	CheckProviders(ctx context.Context, canaries []repository.Canary) []model.ProviderCheck
+	SyncDatasetVersion(ctx context.Context) (*model.ReloadResult, error)
+	ReloadDatabases(ctx context.Context) (*model.ReloadResult, error)
+	StartWarmup(ctx context.Context, req model.WarmupRequest) (*model.WarmupStatus, error)
+	WarmupStatus() *model.WarmupStatus
+	CancelWarmup() bool
+	InspectCache(ctx context.Context, ip string, mode string) (*model.CacheEntryDetail, error)
+	FlushCache(ctx context.Context, req model.CacheFlushRequest) (*model.CacheFlushStatus, error)
+	FlushStatus() *model.CacheFlushStatus
+}
+
+// ServiceOptions IP Service 選項
+type ServiceOptions struct {
+	CacheTTL        time.Duration // 快取的 soft TTL
+	TTLPolicy       TTLPolicy     // 依來源、提供者、國家調整 soft TTL（Default 未設定時使用 CacheTTL）
+	NegativeTTL     time.Duration // 查無資料結果的快取時間（0 表示不快取）
+	LookupTimeout   time.Duration // 單次提供者查詢的總時限（0 表示不限制）
+	StaleAfter      time.Duration // 資料庫建置超過此時間視為過期（0 表示不檢查）
+	CleanupPrevious bool          // 資料集版本改變時在背景刪除上一代快取
+	Warmup          WarmupOptions // 快取預熱
 }
 
 type ipService struct {
-	geoip    repository.GeoIPRepository
-	cache    repository.CacheRepository
-	logger   zerolog.Logger
-	cacheTTL time.Duration
+	geoip         repository.GeoIPRepository
+	cache         repository.CacheRepository
+	logger        zerolog.Logger
+	ttl           TTLPolicy     // 快取 soft TTL 策略
+	negativeTTL   time.Duration // 查無資料結果的快取時間（0 表示不快取）
+	lookupTimeout time.Duration // 單次提供者查詢的總時限（0 表示不限制）
+	staleAfter    time.Duration // 資料庫建置超過此時間視為過期（0 表示不檢查）
+	cleanup       bool          // 資料集版本改變時在背景刪除上一代快取
+	inflight      lookupGroup   // 合併同一快取鍵的並行查詢
+	warmupOpts    WarmupOptions // 快取預熱選項
+	warmup        warmupJob     // 進行中或最近一次的預熱
+	hot           hotIPCounter  // 熱門 IP 查詢次數
+	flush         flushJob      // 進行中或最近一次的選擇性清除
 
 	// 統計資料
 	stats struct {
-		totalQueries uint64
-		cacheHits    uint64
-		cacheMisses  uint64
-		totalErrors  uint64
-		totalTime    uint64 // 累計查詢時間（微秒）
-		queryCount   uint64 // 用於計算平均時間
+		totalQueries      uint64
+		cacheHits         uint64
+		cacheMisses       uint64
+		coalescedRequests uint64 // 共用其他請求查詢結果的次數
+		staleHits         uint64 // 回傳已超過 soft TTL 的快取次數
+		refreshes         uint64 // 背景更新快取的次數
+		totalErrors       uint64
+		totalTime         uint64 // 累計查詢時間（微秒）
+		queryCount        uint64 // 用於計算平均時間
 	}
 }
 
@@ -44,62 +82,186 @@ func NewIPService(
 	geoip repository.GeoIPRepository,
 	cache repository.CacheRepository,
 	logger zerolog.Logger,
-	cacheTTL time.Duration,
+	opts ServiceOptions,
 ) IPService {
+	ttl := opts.TTLPolicy
+	if ttl.Default <= 0 {
+		ttl.Default = opts.CacheTTL
+	}
+
 	return &ipService{
-		geoip:    geoip,
-		cache:    cache,
-		logger:   logger,
-		cacheTTL: cacheTTL,
+		geoip:         geoip,
+		cache:         cache,
+		logger:        logger,
+		ttl:           ttl,
+		negativeTTL:   opts.NegativeTTL,
+		lookupTimeout: opts.LookupTimeout,
+		staleAfter:    opts.StaleAfter,
+		cleanup:       opts.CleanupPrevious,
+		warmupOpts:    opts.Warmup,
 	}
 }
 
+// scopedModes 使用獨立快取鍵的查詢模式（預設路由模式直接以 IP 為鍵）
+var scopedModes = []string{repository.LookupModeMerge, repository.LookupModeConsensus}
+
 // LookupIP 查詢單一 IP（Cache-Aside Pattern）
 func (s *ipService) LookupIP(ctx context.Context, ip string) (*model.IPInfo, error) {
+	return s.LookupIPWithMode(ctx, ip, "")
+}
+
+// LookupIPWithMode 依指定模式查詢單一 IP（route / merge / consensus），空字串為預設路由模式
+func (s *ipService) LookupIPWithMode(ctx context.Context, ip string, mode string) (*model.IPInfo, error) {
+	if !repository.IsValidLookupMode(mode) {
+		return nil, fmt.Errorf("%w: %s", repository.ErrUnknownMode, mode)
+	}
+
+	if _, isMulti := s.geoip.(*repository.MultiProviderRepository); !isMulti {
+		// 單一提供者時各模式結果相同
+		mode = ""
+	}
+
 	startTime := time.Now()
 	atomic.AddUint64(&s.stats.totalQueries, 1)
 
-	// 1. 嘗試從 Redis 快取讀取
-	result, err := s.cache.Get(ctx, ip)
+	if net.ParseIP(ip) == nil {
+		atomic.AddUint64(&s.stats.totalErrors, 1)
+		return nil, repository.ErrInvalidIP
+	}
+
+	// 保留位址不會有地理位置資料，不查詢提供者也不佔用快取
+	if validator.IsReservedIP(ip) {
+		s.recordQueryTime(startTime)
+		return nil, repository.ErrReservedIP
+	}
+	s.trackHotIP(ip)
+
+	return s.lookupCached(ctx, ip, lookupScope{mode: mode}, startTime)
+}
+
+// lookupCached 依查詢範圍讀取快取，未命中時查詢提供者並寫入快取
+func (s *ipService) lookupCached(ctx context.Context, ip string, scope lookupScope, startTime time.Time) (*model.IPInfo, error) {
+	// 1. 嘗試從 Redis 快取讀取（超過 soft TTL 或即將到期時先回傳快取，再於背景更新）
+	key := scope.key(ip)
+	entry, err := s.cache.Get(ctx, key)
 	if err == nil {
 		atomic.AddUint64(&s.stats.cacheHits, 1)
+		s.revalidate(key, ip, scope, entry.Freshness)
 		s.recordQueryTime(startTime)
 		// 標記資料來源為 cache
-		result.Source = "cache"
-		return result, nil
+		entry.Info.Source = "cache"
+		entry.Info.QueryTimeMs = time.Since(startTime).Milliseconds()
+		return entry.Info, nil
+	}
+
+	// 快取為查無資料時直接回傳，不再查詢提供者
+	if errors.Is(err, repository.ErrNegativeCache) {
+		atomic.AddUint64(&s.stats.cacheHits, 1)
+		s.recordQueryTime(startTime)
+		return nil, err
 	}
 
-	// 2. Redis 錯誤時記錄但不中斷服務
-	if err != redis.Nil {
-		s.logger.Warn().Err(err).Str("ip", ip).Msg("Redis cache error, fallback to DB")
+	// 2. 快取錯誤時記錄但不中斷服務；無法解碼的快取視為未命中，查詢後以新格式覆寫
+	switch {
+	case errors.Is(err, repository.ErrCacheMiss):
+	case errors.Is(err, repository.ErrCacheDecode):
+		s.logger.Debug().Err(err).Str("ip", ip).Msg("Discarding undecodable cache entry")
+	default:
+		s.logger.Warn().Err(err).Str("ip", ip).Msg("Cache error, fallback to DB")
 	}
 	atomic.AddUint64(&s.stats.cacheMisses, 1)
 
-	// 3. 查詢 GeoIP (DB or API)
-	result, err = s.geoip.LookupCountry(ip)
+	// 3. 查詢 GeoIP (DB or API)，同一快取鍵的並行查詢只執行一次
+	result, err := s.lookupCoalesced(ctx, key, func() (*model.IPInfo, error) {
+		return s.lookupAndCache(ctx, key, ip, scope, startTime)
+	})
 	if err != nil {
 		atomic.AddUint64(&s.stats.totalErrors, 1)
 		return nil, err
 	}
 
-	// 標記資料來源：根據 provider 判斷是 db 還是 api
-	switch result.Provider {
-	case "ip-api", "ipinfo", "ipapi.co":
-		result.Source = "api"
+	s.recordQueryTime(startTime)
+	return result, nil
+}
+
+// revalidate 快取已超過 soft TTL 或即將到期時，在背景重新查詢並更新快取
+// 同一快取鍵已有進行中的查詢時不重複更新；更新失敗時保留舊快取直到 hard TTL
+func (s *ipService) revalidate(key, ip string, scope lookupScope, freshness repository.Freshness) {
+	if freshness == repository.Fresh {
+		return
+	}
+	if freshness == repository.Stale {
+		atomic.AddUint64(&s.stats.staleHits, 1)
+	}
+
+	call, leader := s.inflight.join(key)
+	if !leader {
+		return
+	}
+
+	atomic.AddUint64(&s.stats.refreshes, 1)
+	go func() {
+		info, err := s.lookupAndCache(context.Background(), key, ip, scope, time.Now())
+		if err != nil {
+			s.logger.Debug().Err(err).Str("ip", ip).Msg("Failed to refresh cached result")
+		}
+		s.inflight.finish(key, call, info, err)
+	}()
+}
+
+// lookupCoalesced 合併同一快取鍵的並行查詢：沒有進行中的查詢時執行 lookup，否則等待並共用結果
+// 發起查詢的請求被取消時，等待中的請求改為自行查詢
+func (s *ipService) lookupCoalesced(ctx context.Context, key string, lookup func() (*model.IPInfo, error)) (*model.IPInfo, error) {
+	call, leader := s.inflight.join(key)
+	if leader {
+		info, err := lookup()
+		s.inflight.finish(key, call, info, err)
+		return info, err
+	}
+
+	atomic.AddUint64(&s.stats.coalescedRequests, 1)
+	info, err := call.wait(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		return lookup()
+	}
+	return info, err
+}
+
+// lookupAndCache 查詢提供者並寫入快取（失敗不影響回應）
+// 只快取提供者明確回報的查無資料，逾時或提供者故障不快取
+func (s *ipService) lookupAndCache(ctx context.Context, key, ip string, scope lookupScope, startTime time.Time) (*model.IPInfo, error) {
+	lookupCtx, cancel := s.withLookupTimeout(ctx)
+	defer cancel()
+
+	var result *model.IPInfo
+	var err error
+	multiRepo, isMulti := s.geoip.(*repository.MultiProviderRepository)
+	switch {
+	case isMulti && scope.provider != "":
+		result, err = multiRepo.LookupByProvider(lookupCtx, ip, scope.provider)
+	case isMulti:
+		result, err = multiRepo.LookupWithMode(lookupCtx, ip, scope.mode)
 	default:
-		result.Source = "db"
+		result, err = s.geoip.LookupCountry(lookupCtx, ip)
+	}
+	if err != nil {
+		if repository.IsNotFound(err) && s.negativeTTL > 0 {
+			if cacheErr := s.cache.SetNotFound(ctx, key, s.negativeTTL); cacheErr != nil {
+				s.logger.Warn().Err(cacheErr).Str("ip", ip).Msg("Failed to cache not-found result")
+			}
+		}
+		return nil, err
 	}
 
+	// 標記資料來源：根據 provider 判斷是 db 還是 api
+	result.Source = repository.ResultSource(result)
+
 	// 記錄查詢時間
-	queryTime := time.Since(startTime)
-	result.QueryTimeMs = queryTime.Milliseconds()
+	result.QueryTimeMs = time.Since(startTime).Milliseconds()
 
-	// 4. 嘗試寫入快取（失敗不影響回應）
-	if cacheErr := s.cache.Set(ctx, ip, result, s.cacheTTL); cacheErr != nil {
+	if cacheErr := s.cache.Set(ctx, key, result, s.ttl.ttlForScope(result, scope)); cacheErr != nil {
 		s.logger.Warn().Err(cacheErr).Str("ip", ip).Msg("Failed to cache result")
 	}
-
-	s.recordQueryTime(startTime)
 	return result, nil
 }
 
@@ -120,54 +282,46 @@ func (s *ipService) BatchLookup(ctx context.Context, ips []string) (*model.Batch
 	cachedResults, err := s.cache.MGet(ctx, ips)
 	if err != nil {
 		s.logger.Warn().Err(err).Msg("Batch cache lookup failed")
-		cachedResults = make(map[string]*model.IPInfo)
+		cachedResults = make(map[string]*repository.CacheEntry)
 	}
 
-	// 標記快取結果來源
-	for _, info := range cachedResults {
-		info.Source = "cache"
+	// 標記快取結果來源（Info 為 nil 是快取的查無資料），過期的結果在背景更新
+	for ip, entry := range cachedResults {
+		if entry.Info != nil {
+			s.revalidate(cacheKey("", ip), ip, lookupScope{}, entry.Freshness)
+			entry.Info.Source = "cache"
+		}
 	}
 
-	// 2. 收集未命中的 IP
+	// 2. 收集未命中的 IP（格式錯誤與保留位址不查詢）
 	var missedIPs []string
 	for _, ip := range ips {
-		if _, found := cachedResults[ip]; !found {
-			missedIPs = append(missedIPs, ip)
+		if _, found := cachedResults[ip]; found {
+			s.trackHotIP(ip)
+			continue
 		}
+		if net.ParseIP(ip) == nil || validator.IsReservedIP(ip) {
+			continue
+		}
+		s.trackHotIP(ip)
+		missedIPs = append(missedIPs, ip)
 	}
 
 	atomic.AddUint64(&s.stats.cacheHits, uint64(len(cachedResults)))
 	atomic.AddUint64(&s.stats.cacheMisses, uint64(len(missedIPs)))
 
-	// 3. 並行查詢 MaxMind DB（未命中的 IP）
+	// 3. 並行查詢未命中的 IP（查詢結果會寫入快取）
 	dbResults := s.parallelLookup(ctx, missedIPs)
 
-	// 標記 DB/API 結果來源
-	for _, info := range dbResults {
-		switch info.Provider {
-		case "ip-api", "ipinfo", "ipapi.co":
-			info.Source = "api"
-		default:
-			info.Source = "db"
-		}
-	}
-
-	// 4. 批次寫入快取
-	if len(dbResults) > 0 {
-		if err := s.cache.MSet(ctx, dbResults, s.cacheTTL); err != nil {
-			s.logger.Warn().Err(err).Msg("Batch cache write failed")
-		}
-	}
-
-	// 5. 合併結果
+	// 4. 合併結果
 	allResults := make([]model.IPInfo, 0, len(ips))
 	successCount := 0
 	failedCount := 0
 
 	for _, ip := range ips {
 		// 先從快取找
-		if info, found := cachedResults[ip]; found {
-			allResults = append(allResults, *info)
+		if entry, found := cachedResults[ip]; found && entry.Info != nil {
+			allResults = append(allResults, *entry.Info)
 			successCount++
 			continue
 		}
@@ -189,8 +343,86 @@ func (s *ipService) BatchLookup(ctx context.Context, ips []string) (*model.Batch
 	}, nil
 }
 
-// parallelLookup 並行查詢 MaxMind DB
+// parallelLookup 並行查詢未命中快取的 IP 並批次寫入快取
+// 與其他請求進行中的相同查詢合併，只查詢沒有人在查詢的 IP
 func (s *ipService) parallelLookup(ctx context.Context, ips []string) map[string]*model.IPInfo {
+	if len(ips) == 0 {
+		return make(map[string]*model.IPInfo)
+	}
+
+	var owned []string
+	calls := make(map[string]*lookupCall, len(ips))
+	waiting := make(map[string]*lookupCall)
+	for _, ip := range ips {
+		if _, ok := calls[ip]; ok {
+			continue
+		}
+		call, leader := s.inflight.join(cacheKey("", ip))
+		if leader {
+			owned = append(owned, ip)
+			calls[ip] = call
+		} else {
+			waiting[ip] = call
+		}
+	}
+
+	results := s.lookupEach(ctx, owned)
+
+	// 標記 DB/API 結果來源
+	for _, info := range results {
+		info.Source = repository.ResultSource(info)
+	}
+
+	// 先寫入快取再喚醒等待的請求，避免其他請求在寫入前再次查詢
+	if len(results) > 0 {
+		for ttl, group := range s.ttl.groupByTTL(results) {
+			if err := s.cache.MSet(ctx, group, ttl); err != nil {
+				s.logger.Warn().Err(err).Msg("Batch cache write failed")
+			}
+		}
+	}
+
+	for ip, call := range calls {
+		info, found := results[ip]
+		var err error
+		if !found {
+			if err = ctx.Err(); err == nil {
+				err = repository.ErrAllFailed
+			}
+		}
+		s.inflight.finish(cacheKey("", ip), call, info, err)
+	}
+
+	if len(waiting) > 0 {
+		atomic.AddUint64(&s.stats.coalescedRequests, uint64(len(waiting)))
+	}
+	for ip, call := range waiting {
+		if info, err := call.wait(ctx); err == nil {
+			results[ip] = info
+		}
+	}
+
+	return results
+}
+
+// lookupEach 並行查詢多個 IP，回傳查到的結果
+func (s *ipService) lookupEach(ctx context.Context, ips []string) map[string]*model.IPInfo {
+	if len(ips) == 0 {
+		return make(map[string]*model.IPInfo)
+	}
+
+	// 有支援批次的外部 API 時，交由 MultiProvider 合併成批次請求
+	if multiRepo, ok := s.geoip.(*repository.MultiProviderRepository); ok && multiRepo.HasBatchProvider() {
+		lookupCtx, cancel := s.withLookupTimeout(ctx)
+		results := multiRepo.LookupBatch(lookupCtx, ips)
+		cancel()
+		if failed := len(ips) - len(results); failed > 0 {
+			atomic.AddUint64(&s.stats.totalErrors, uint64(failed))
+			s.logger.Debug().Int("failed", failed).Msg("Failed to lookup some IPs in batch")
+		}
+		return results
+	}
+
 	results := make(map[string]*model.IPInfo)
 	var mu sync.Mutex
 	var wg sync.WaitGroup
@@ -203,10 +435,18 @@ func (s *ipService) parallelLookup(ctx context.Context, ips []string) map[string
 		go func(ipAddr string) {
 			defer wg.Done()
 
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+			// 請求已取消時不再等待並行名額
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				return
+			}
+
+			lookupCtx, cancel := s.withLookupTimeout(ctx)
+			defer cancel()
 
-			info, err := s.geoip.LookupCountry(ipAddr)
+			info, err := s.geoip.LookupCountry(lookupCtx, ipAddr)
 			if err != nil {
 				atomic.AddUint64(&s.stats.totalErrors, 1)
 				s.logger.Debug().Err(err).Str("ip", ipAddr).Msg("Failed to lookup IP")
@@ -243,51 +483,70 @@ func (s *ipService) GetStats() *model.ServiceStats {
 	}
 
 	return &model.ServiceStats{
-		TotalQueries: totalQueries,
-		CacheHits:    cacheHits,
-		CacheMisses:  cacheMisses,
-		CacheHitRate: hitRate,
-		AvgQueryTime: avgQueryTime,
-		TotalErrors:  totalErrors,
+		TotalQueries:      totalQueries,
+		CacheHits:         cacheHits,
+		CacheMisses:       cacheMisses,
+		CacheHitRate:      hitRate,
+		CoalescedRequests: atomic.LoadUint64(&s.stats.coalescedRequests),
+		StaleHits:         atomic.LoadUint64(&s.stats.staleHits),
+		Refreshes:         atomic.LoadUint64(&s.stats.refreshes),
+		AvgQueryTime:      avgQueryTime,
+		TotalErrors:       totalErrors,
 	}
 }
 
-// InvalidateCache 清除指定 IP 的快取
-func (s *ipService) InvalidateCache(ctx context.Context, ips ...string) error {
-	return s.cache.Delete(ctx, ips...)
+// InvalidateCache 清除指定 IP 的快取（包含查無資料的快取）
+// 未指定提供者時清除各查詢模式與各提供者的快取，指定時只清除該提供者的快取
+func (s *ipService) InvalidateCache(ctx context.Context, provider string, ips ...string) error {
+	var scopes []lookupScope
+	if provider != "" {
+		scopes = []lookupScope{{provider: provider}}
+	} else {
+		scopes = append(scopes, lookupScope{})
+		for _, mode := range scopedModes {
+			scopes = append(scopes, lookupScope{mode: mode})
+		}
+		for _, name := range s.GetAvailableProviders() {
+			scopes = append(scopes, lookupScope{provider: name})
+		}
+	}
+
+	keys := make([]string, 0, len(ips)*len(scopes))
+	for _, ip := range ips {
+		for _, scope := range scopes {
+			keys = append(keys, scope.key(ip))
+		}
+	}
+	return s.cache.Delete(ctx, keys...)
 }
 
 // LookupIPByProvider 使用指定的提供者查詢 IP
 func (s *ipService) LookupIPByProvider(ctx context.Context, ip string, provider string) (*model.IPInfo, error) {
+	// 如果不是 MultiProvider，使用一般查詢
+	if _, ok := s.geoip.(*repository.MultiProviderRepository); !ok {
+		return s.LookupIP(ctx, ip)
+	}
+
 	startTime := time.Now()
 	atomic.AddUint64(&s.stats.totalQueries, 1)
 
-	// 檢查是否為 MultiProvider
-	if multiRepo, ok := s.geoip.(*repository.MultiProviderRepository); ok {
-		result, err := multiRepo.LookupByProvider(ip, provider)
-		if err != nil {
-			atomic.AddUint64(&s.stats.totalErrors, 1)
-			s.logger.Error().Err(err).Str("ip", ip).Str("provider", provider).Msg("Provider lookup failed")
-			return nil, err
-		}
-
-		// 標記資料來源：指定 provider 時直接查詢，不使用快取
-		switch provider {
-		case "ip-api", "ipinfo", "ipapi.co":
-			result.Source = "api"
-		default:
-			result.Source = "db"
-		}
+	if net.ParseIP(ip) == nil {
+		atomic.AddUint64(&s.stats.totalErrors, 1)
+		return nil, repository.ErrInvalidIP
+	}
 
-		// 記錄查詢時間
-		result.QueryTimeMs = time.Since(startTime).Milliseconds()
+	// 保留位址不送往指定的提供者，避免消耗外部 API 配額
+	if validator.IsReservedIP(ip) {
 		s.recordQueryTime(startTime)
-
-		return result, nil
+		return nil, repository.ErrReservedIP
 	}
 
-	// 如果不是 MultiProvider，使用一般查詢
-	return s.LookupIP(ctx, ip)
+	// 指定提供者的結果以獨立的快取鍵快取，避免比對工具重複消耗外部 API 配額
+	result, err := s.lookupCached(ctx, ip, lookupScope{provider: provider}, startTime)
+	if err != nil && !repository.IsNotFound(err) {
+		s.logger.Error().Err(err).Str("ip", ip).Str("provider", provider).Msg("Provider lookup failed")
+	}
+	return result, err
 }
 
 // GetAvailableProviders 取得所有可用的提供者
@@ -300,6 +559,128 @@ func (s *ipService) GetAvailableProviders() []string {
 	return []string{s.geoip.GetProviderType()}
 }
 
+// GetProviderStatuses 取得所有提供者的狀態（含資料庫中繼資料與過期標記）
+func (s *ipService) GetProviderStatuses(ctx context.Context) []model.ProviderStatus {
+	var statuses []model.ProviderStatus
+	if multiRepo, ok := s.geoip.(*repository.MultiProviderRepository); ok {
+		statuses = multiRepo.GetProviderStatuses(ctx)
+	} else {
+		providerType := s.geoip.GetProviderType()
+		statuses = []model.ProviderStatus{{
+			Name:     providerType,
+			Kind:     repository.ProviderKind(providerType),
+			Metadata: repository.DescribeProvider(s.geoip),
+		}}
+	}
+
+	for i := range statuses {
+		repository.MarkStale(statuses[i].Metadata, s.staleAfter)
+	}
+	return statuses
+}
+
+// CheckProviders 以 canary IP 逐一檢查每個提供者
+func (s *ipService) CheckProviders(ctx context.Context, canaries []repository.Canary) []model.ProviderCheck {
+	if multiRepo, ok := s.geoip.(*repository.MultiProviderRepository); ok {
+		return multiRepo.CheckProviders(ctx, canaries)
+	}
+
+	return []model.ProviderCheck{repository.CheckProvider(ctx, s.geoip, canaries)}
+}
+
+// SyncDatasetVersion 依目前載入的資料庫切換快取命名空間
+// 版本改變時新的查詢立即使用新命名空間，上一代快取依 TTL 自然過期或在背景刪除
+func (s *ipService) SyncDatasetVersion(ctx context.Context) (*model.ReloadResult, error) {
+	version := repository.DatasetVersion(s.geoip)
+	previous, err := s.cache.UseDatasetVersion(ctx, version)
+	if err != nil {
+		// 無法讀取上一個版本時仍使用新命名空間，只是無法清除上一代快取
+		s.logger.Warn().Err(err).Msg("Failed to record cache dataset version")
+	}
+
+	result := &model.ReloadResult{
+		DatasetVersion:  version,
+		PreviousVersion: previous,
+		Changed:         previous != "" && previous != version,
+	}
+
+	if result.Changed && s.cleanup {
+		result.CleanupStarted = true
+		go s.deleteDatasetVersion(previous)
+	}
+	return result, nil
+}
+
+// ReloadDatabases 重新載入本地資料庫並切換快取命名空間
+func (s *ipService) ReloadDatabases(ctx context.Context) (*model.ReloadResult, error) {
+	if err := repository.ReloadDatabases(s.geoip); err != nil {
+		return nil, err
+	}
+
+	result, err := s.SyncDatasetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 新的命名空間是空的，依設定自動預熱熱門 IP
+	if result.Changed && s.warmupOpts.OnReload {
+		if _, err := s.StartWarmup(ctx, model.WarmupRequest{}); err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to start cache warmup after reload")
+		} else {
+			result.WarmupStarted = true
+		}
+	}
+	return result, nil
+}
+
+// deleteDatasetVersion 在背景刪除上一代的快取
+func (s *ipService) deleteDatasetVersion(version string) {
+	deleted, err := s.cache.DeleteDatasetVersion(context.Background(), version)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("dataset_version", version).Msg("Failed to delete previous cache generation")
+		return
+	}
+	s.logger.Info().
+		Str("dataset_version", version).
+		Int64("deleted_keys", deleted).
+		Msg("Deleted previous cache generation")
+}
+
+// lookupScope 查詢範圍：查詢模式或指定的提供者（兩者擇一），各自使用獨立的快取鍵
+type lookupScope struct {
+	mode     string
+	provider string
+}
+
+// key 查詢範圍的快取鍵
+func (sc lookupScope) key(ip string) string {
+	if sc.provider != "" {
+		return providerCacheKey(sc.provider, ip)
+	}
+	return cacheKey(sc.mode, ip)
+}
+
+// providerCacheKey 指定提供者查詢的快取鍵（IPv6 位址含有 ":"，因此以 "/" 分隔）
+func providerCacheKey(provider, ip string) string {
+	return "provider:" + provider + "/" + ip
+}
+
+// cacheKey 產生快取鍵：預設路由模式直接使用 IP，其他模式加上 "<mode>/" 前綴
+func cacheKey(mode, ip string) string {
+	if mode == "" || mode == repository.LookupModeRoute {
+		return ip
+	}
+	return mode + "/" + ip
+}
+
+// withLookupTimeout 為提供者查詢加上總時限
+func (s *ipService) withLookupTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.lookupTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.lookupTimeout)
+}
+
 // recordQueryTime 記錄查詢時間
 func (s *ipService) recordQueryTime(startTime time.Time) {
 	duration := time.Since(startTime).Microseconds()
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/shengjhe/goip/internal/repository"
+)
+
+// TTLPolicy 依查詢結果決定快取的 soft TTL，未設定（0）的規則略過
+// 優先順序：國家 > 提供者 > 資料來源 > Default；沒有城市資料的結果最多快取 CountryOnly
+type TTLPolicy struct {
+	Default        time.Duration            // 沒有符合的規則時使用（cache.ttl）
+	DB             time.Duration            // 本地資料庫的結果
+	API            time.Duration            // 外部 API 的結果
+	CountryOnly    time.Duration            // 只有國家、沒有城市資料的結果（上限）
+	Providers      map[string]time.Duration // 依提供者
+	Countries      map[string]time.Duration // 依國家 ISO 代碼（大寫）
+	ProviderLookup time.Duration            // 指定提供者查詢的結果（0 表示與一般查詢相同）
+}
+
+// ttlFor 取得結果的 soft TTL
+func (p TTLPolicy) ttlFor(info *model.IPInfo) time.Duration {
+	source := repository.ResultSource(info)
+
+	ttl := p.Default
+	if countryTTL := p.Countries[strings.ToUpper(info.Country.ISOCode)]; countryTTL > 0 {
+		ttl = countryTTL
+	} else if providerTTL := p.Providers[info.Provider]; providerTTL > 0 {
+		ttl = providerTTL
+	} else if source == "api" && p.API > 0 {
+		ttl = p.API
+	} else if source == "db" && p.DB > 0 {
+		ttl = p.DB
+	}
+
+	// 沒有城市資料的結果較快過期，讓之後的查詢有機會取得較完整的資料
+	if p.CountryOnly > 0 && p.CountryOnly < ttl && info.City.Name == "" && info.City.NameZh == "" {
+		ttl = p.CountryOnly
+	}
+	return ttl
+}
+
+// ttlForScope 取得查詢範圍中結果的 soft TTL
+func (p TTLPolicy) ttlForScope(info *model.IPInfo, scope lookupScope) time.Duration {
+	if scope.provider != "" && p.ProviderLookup > 0 {
+		return p.ProviderLookup
+	}
+	return p.ttlFor(info)
+}
+
+// groupByTTL 依各結果的 TTL 分組，供批次寫入快取
+func (p TTLPolicy) groupByTTL(results map[string]*model.IPInfo) map[time.Duration]map[string]*model.IPInfo {
+	groups := make(map[time.Duration]map[string]*model.IPInfo)
+	for ip, info := range results {
+		ttl := p.ttlFor(info)
+		if groups[ttl] == nil {
+			groups[ttl] = make(map[string]*model.IPInfo)
+		}
+		groups[ttl][ip] = info
+	}
+	return groups
+}
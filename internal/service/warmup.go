@@ -0,0 +1,395 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shengjhe/goip/internal/model"
+	"github.com/shengjhe/goip/internal/repository"
+	"github.com/shengjhe/goip/pkg/validator"
+)
+
+const (
+	// hotIPFlushInterval 將累計的查詢次數寫入快取後端的間隔
+	hotIPFlushInterval = time.Minute
+
+	// maxPendingHotIPs 兩次寫入之間最多累計的不同 IP 數量
+	maxPendingHotIPs = 10000
+
+	// warmupConcurrency 預熱同時進行的查詢數
+	warmupConcurrency = 8
+
+	// defaultWarmupRate 未設定時每秒最多查詢數
+	defaultWarmupRate = 50
+
+	// maxWarmupRate 每秒查詢數上限
+	maxWarmupRate = 1000
+
+	// defaultWarmupMaxTargets 未設定時單次預熱最多的 IP 數量
+	defaultWarmupMaxTargets = 10000
+)
+
+var (
+	ErrWarmupRunning   = errors.New("cache warmup already running")
+	ErrNoWarmupTargets = errors.New("no warmup targets")
+)
+
+// WarmupOptions 快取預熱選項
+type WarmupOptions struct {
+	File       string // IP / CIDR 清單檔案（每行一筆，# 開頭為註解）
+	HotIPs     int    // 預設加入查詢次數最多的前 N 個 IP（0 表示不記錄查詢次數）
+	Rate       int    // 每秒最多查詢數
+	MaxTargets int    // 單次預熱最多的 IP 數量（CIDR 展開後）
+	OnReload   bool   // 重新載入資料庫且資料集版本改變時自動預熱
+}
+
+// warmupOutcome 單一 IP 的預熱結果
+type warmupOutcome int
+
+const (
+	warmupWarmed warmupOutcome = iota
+	warmupSkipped
+	warmupNotFound
+	warmupFailed
+)
+
+// hotIPCounter 在本地累計 IP 查詢次數，定期批次寫入快取後端，避免每次查詢都寫入 Redis
+type hotIPCounter struct {
+	mu        sync.Mutex
+	counts    map[string]float64
+	lastFlush time.Time
+}
+
+// add 累計一次查詢，到達寫入間隔時取出累計的次數
+func (h *hotIPCounter) add(ip string, now time.Time) map[string]float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.counts == nil {
+		h.counts = make(map[string]float64)
+		h.lastFlush = now
+	}
+	if _, ok := h.counts[ip]; ok || len(h.counts) < maxPendingHotIPs {
+		h.counts[ip]++
+	}
+
+	if now.Sub(h.lastFlush) < hotIPFlushInterval {
+		return nil
+	}
+	batch := h.counts
+	h.counts = make(map[string]float64)
+	h.lastFlush = now
+	return batch
+}
+
+// warmupJob 進行中或最近一次的預熱
+type warmupJob struct {
+	mu     sync.Mutex
+	status model.WarmupStatus
+	cancel context.CancelFunc
+}
+
+// record 記錄單一 IP 的預熱結果
+func (j *warmupJob) record(outcome warmupOutcome) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.Processed++
+	switch outcome {
+	case warmupWarmed:
+		j.status.Warmed++
+	case warmupSkipped:
+		j.status.Skipped++
+	case warmupNotFound:
+		j.status.NotFound++
+	default:
+		j.status.Failed++
+	}
+}
+
+// snapshot 取得目前進度的副本
+func (j *warmupJob) snapshot() *model.WarmupStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	status.Sources = append([]string(nil), j.status.Sources...)
+	return &status
+}
+
+// trackHotIP 記錄 IP 查詢次數，供預熱時取得熱門 IP
+func (s *ipService) trackHotIP(ip string) {
+	if s.warmupOpts.HotIPs <= 0 {
+		return
+	}
+
+	batch := s.hot.add(ip, time.Now())
+	if batch == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.cache.IncrHotIPs(ctx, batch); err != nil {
+			s.logger.Debug().Err(err).Int("ips", len(batch)).Msg("Failed to record hot IPs")
+		}
+	}()
+}
+
+// StartWarmup 在背景以有限速率查詢指定的 IP 並寫入快取；已有進行中的預熱時回傳 ErrWarmupRunning
+// 請求未指定任何來源時使用配置的檔案與熱門 IP
+func (s *ipService) StartWarmup(ctx context.Context, req model.WarmupRequest) (*model.WarmupStatus, error) {
+	s.warmup.mu.Lock()
+	defer s.warmup.mu.Unlock()
+
+	if s.warmup.status.Running {
+		return nil, ErrWarmupRunning
+	}
+
+	targets, sources, err := s.collectWarmupTargets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := req.Rate
+	if rate <= 0 {
+		rate = s.warmupOpts.Rate
+	}
+	if rate <= 0 {
+		rate = defaultWarmupRate
+	}
+	if rate > maxWarmupRate {
+		rate = maxWarmupRate
+	}
+
+	now := time.Now()
+	jobCtx, cancel := context.WithCancel(context.Background())
+	s.warmup.cancel = cancel
+	s.warmup.status = model.WarmupStatus{
+		Running:   true,
+		Sources:   sources,
+		Total:     len(targets),
+		StartedAt: &now,
+	}
+
+	s.logger.Info().Strs("sources", sources).Int("total", len(targets)).Int("rate", rate).Msg("Cache warmup started")
+	go s.runWarmup(jobCtx, targets, rate)
+
+	status := s.warmup.status
+	return &status, nil
+}
+
+// WarmupStatus 取得進行中或最近一次預熱的進度
+func (s *ipService) WarmupStatus() *model.WarmupStatus {
+	return s.warmup.snapshot()
+}
+
+// CancelWarmup 中止進行中的預熱，沒有進行中的預熱時回傳 false
+func (s *ipService) CancelWarmup() bool {
+	s.warmup.mu.Lock()
+	defer s.warmup.mu.Unlock()
+
+	if !s.warmup.status.Running {
+		return false
+	}
+	s.warmup.cancel()
+	return true
+}
+
+// runWarmup 依速率逐一預熱，同時最多 warmupConcurrency 個查詢
+func (s *ipService) runWarmup(ctx context.Context, targets []string, rate int) {
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, warmupConcurrency)
+	var wg sync.WaitGroup
+
+dispatch:
+	for _, ip := range targets {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case <-ticker.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.warmup.record(s.warmupOne(ctx, ip))
+		}(ip)
+	}
+	wg.Wait()
+
+	s.warmup.mu.Lock()
+	now := time.Now()
+	s.warmup.status.Running = false
+	s.warmup.status.FinishedAt = &now
+	if err := ctx.Err(); err != nil {
+		s.warmup.status.Error = err.Error()
+	}
+	s.warmup.cancel()
+	status := s.warmup.status
+	s.warmup.mu.Unlock()
+
+	s.logger.Info().
+		Int("total", status.Total).
+		Int("processed", status.Processed).
+		Int("warmed", status.Warmed).
+		Int("skipped", status.Skipped).
+		Int("not_found", status.NotFound).
+		Int("failed", status.Failed).
+		Str("error", status.Error).
+		Msg("Cache warmup finished")
+}
+
+// warmupOne 預熱單一 IP：快取中已有未過期的結果時略過，否則經由一般的提供者鏈查詢並寫入快取
+func (s *ipService) warmupOne(ctx context.Context, ip string) warmupOutcome {
+	key := cacheKey("", ip)
+
+	entry, err := s.cache.Get(ctx, key)
+	if (err == nil && entry.Freshness == repository.Fresh) || errors.Is(err, repository.ErrNegativeCache) {
+		return warmupSkipped
+	}
+
+	_, err = s.lookupCoalesced(ctx, key, func() (*model.IPInfo, error) {
+		return s.lookupAndCache(ctx, key, ip, lookupScope{}, time.Now())
+	})
+	switch {
+	case err == nil:
+		return warmupWarmed
+	case repository.IsNotFound(err):
+		return warmupNotFound
+	default:
+		return warmupFailed
+	}
+}
+
+// collectWarmupTargets 收集預熱的 IP（CIDR 展開、去除重複與保留位址，最多 MaxTargets 個）
+func (s *ipService) collectWarmupTargets(ctx context.Context, req model.WarmupRequest) ([]string, []string, error) {
+	if len(req.Targets) == 0 && !req.UseFile && req.HotIPs <= 0 {
+		req.UseFile = s.warmupOpts.File != ""
+		req.HotIPs = s.warmupOpts.HotIPs
+	}
+
+	limit := s.warmupOpts.MaxTargets
+	if limit <= 0 {
+		limit = defaultWarmupMaxTargets
+	}
+	set := &warmupTargets{seen: make(map[string]bool), limit: limit}
+	var sources []string
+
+	if len(req.Targets) > 0 {
+		sources = append(sources, "targets")
+		for _, target := range req.Targets {
+			if err := set.add(target); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if req.UseFile {
+		if s.warmupOpts.File == "" {
+			return nil, nil, fmt.Errorf("%w: cache.warmup.file is not configured", ErrNoWarmupTargets)
+		}
+		sources = append(sources, "file")
+		if err := set.addFile(s.warmupOpts.File); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if req.HotIPs > 0 {
+		sources = append(sources, "hot_ips")
+		hot, err := s.cache.HotIPs(ctx, req.HotIPs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load hot IPs: %w", err)
+		}
+		for _, ip := range hot {
+			// 記錄中的 IP 都來自成功的查詢，格式錯誤時略過即可
+			set.add(ip)
+		}
+	}
+
+	if len(set.ips) == 0 {
+		return nil, nil, ErrNoWarmupTargets
+	}
+	return set.ips, sources, nil
+}
+
+// warmupTargets 預熱 IP 集合
+type warmupTargets struct {
+	ips   []string
+	seen  map[string]bool
+	limit int
+}
+
+// add 加入 IP 或 CIDR（CIDR 從網段起點展開，超過上限的部分忽略）
+func (t *warmupTargets) add(target string) error {
+	target = strings.TrimSpace(target)
+
+	if strings.Contains(target, "/") {
+		prefix, err := netip.ParsePrefix(target)
+		if err != nil {
+			return fmt.Errorf("%w: %s", repository.ErrInvalidIP, target)
+		}
+		// 最多檢查 limit 個位址，避免大範圍的保留位址（例如 10.0.0.0/8）逐一檢查
+		addr := prefix.Masked().Addr()
+		for n := 0; n < t.limit && len(t.ips) < t.limit && prefix.Contains(addr); n++ {
+			t.addAddr(addr)
+			addr = addr.Next()
+		}
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(target)
+	if err != nil {
+		return fmt.Errorf("%w: %s", repository.ErrInvalidIP, target)
+	}
+	t.addAddr(addr)
+	return nil
+}
+
+// addAddr 加入單一位址（保留位址不會有地理位置資料，略過）
+func (t *warmupTargets) addAddr(addr netip.Addr) {
+	ip := addr.Unmap().String()
+	if len(t.ips) >= t.limit || t.seen[ip] || validator.IsReservedIP(ip) {
+		return
+	}
+	t.seen[ip] = true
+	t.ips = append(t.ips, ip)
+}
+
+// addFile 讀取清單檔案，每行一個 IP 或 CIDR，空行與 # 開頭的行忽略
+func (t *warmupTargets) addFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open warmup file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := t.add(text); err != nil {
+			return fmt.Errorf("warmup file line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
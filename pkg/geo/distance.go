@@ -0,0 +1,23 @@
+package geo
+
+import "math"
+
+// earthRadiusKm 地球平均半徑（公里）
+const earthRadiusKm = 6371.0
+
+// DistanceKm 使用 Haversine 公式計算兩個經緯度座標之間的大圓距離（公里）
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// toRadians 角度轉弧度
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -62,6 +62,59 @@ func IsPrivateIP(ip string) bool {
 	return false
 }
 
+// reservedIPBlocks 保留位址範圍（不可公開路由，GeoIP 資料庫不會有地理位置資料）
+var reservedIPBlocks = parseCIDRs(
+	"0.0.0.0/8",       // 本網路
+	"10.0.0.0/8",      // 私有網路
+	"100.64.0.0/10",   // CGNAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local
+	"172.16.0.0/12",   // 私有網路
+	"192.0.0.0/24",    // IETF 協定指派
+	"192.0.2.0/24",    // 文件範例（TEST-NET-1）
+	"192.168.0.0/16",  // 私有網路
+	"198.18.0.0/15",   // 效能測試
+	"198.51.100.0/24", // 文件範例（TEST-NET-2）
+	"203.0.113.0/24",  // 文件範例（TEST-NET-3）
+	"224.0.0.0/4",     // 多播
+	"240.0.0.0/4",     // 保留（含廣播位址）
+	"::/128",          // 未指定位址
+	"::1/128",         // loopback
+	"100::/64",        // 丟棄前綴
+	"2001:db8::/32",   // 文件範例
+	"fc00::/7",        // 唯一本地位址
+	"fe80::/10",       // link-local
+	"ff00::/8",        // 多播
+)
+
+// IsReservedIP 判斷是否為保留位址（私有、loopback、link-local、CGNAT、文件範例、多播等）
+func IsReservedIP(ip string) bool {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+
+	for _, block := range reservedIPBlocks {
+		if block.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRs 解析固定的 CIDR 清單
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	blocks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
 // IsLoopbackIP 判斷是否為 Loopback IP
 func IsLoopbackIP(ip string) bool {
 	parsedIP := net.ParseIP(ip)